@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// ansiColors are the terminal colors by Severity
+var ansiColors = map[string]string{
+	"danger":  "\x1b[31m",
+	"warning": "\x1b[33m",
+	"good":    "\x1b[32m",
+}
+
+// ansiReset ends a colored segment
+const ansiReset = "\x1b[0m"
+
+// UseColor decides whether output to out is colored for -color: always, never, or auto,
+// which colors terminals unless NO_COLOR is set (https://no-color.org)
+func UseColor(mode string, out *os.File) (bool, error) {
+	switch mode {
+	case "always":
+		return true, nil
+	case "never":
+		return false, nil
+	case "auto":
+		if os.Getenv("NO_COLOR") != "" {
+			return false, nil
+		}
+		info, err := out.Stat()
+		return err == nil && info.Mode()&os.ModeCharDevice != 0, nil
+	default:
+		return false, fmt.Errorf("Unknown color mode %q: must be auto, always or never", mode)
+	}
+}
+
+// colorize wraps s in the terminal color of severity if enabled
+func colorize(enabled bool, severity string, s string) string {
+	if !enabled {
+		return s
+	}
+	return ansiColors[severity] + s + ansiReset
+}
+
+// alertSeverity is the Severity of alert, or good for disks above their threshold and recovered ones
+func alertSeverity(alert Alert, critical uint64) string {
+	if alert.Recovered || !(alert.ReadOnly || alert.Threshold.Breached(alert.Disk)) {
+		return "good"
+	}
+	return Severity(alert, critical)
+}
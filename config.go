@@ -0,0 +1,331 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/danthelion/diskspace2slack/diskspace"
+)
+
+// DiskConfig holds the alerting settings of a single disk
+type DiskConfig struct {
+	Threshold diskspace.Threshold `json:"threshold"`
+	// Target overrides the -target flag for this disk when set
+	Target string `json:"target"`
+	// Label is a friendly name shown along with the path in reports, e.g. App Data
+	Label string `json:"label"`
+}
+
+// Config is the layout of the JSON file passed via -config, e.g.
+//
+//	{"disks": {"/": {"threshold": 10, "target": "#ops"}, "/srv/app/data": {"threshold": "500M", "label": "App Data"}}}
+type Config struct {
+	Disks map[string]DiskConfig `json:"disks"`
+	// Template replaces DefaultTemplate unless -template is set
+	Template string `json:"template"`
+	// CooldownExempt lists the notifiers that get every alert regardless of -cooldown, e.g. ["pagerduty"]
+	CooldownExempt []string `json:"cooldown_exempt"`
+}
+
+// LoadConfig reads the config file at path, rejecting unknown keys
+func LoadConfig(path string) (Config, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return Config{}, err
+	}
+	defer file.Close()
+
+	config := Config{}
+	decoder := json.NewDecoder(file)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&config); err != nil {
+		return Config{}, fmt.Errorf("Invalid config file %s: %v", path, err)
+	}
+	if len(config.Disks) == 0 {
+		return Config{}, errors.New("Invalid config file " + path + ": no disks configured")
+	}
+	return config, nil
+}
+
+// ParseTargetMap parses space separated path=target pairs, e.g. `/var/lib/mysql=#dba /srv=#web`
+func ParseTargetMap(s string) (map[string]string, error) {
+	targets := make(map[string]string)
+	for _, pair := range strings.Fields(s) {
+		i := strings.Index(pair, "=")
+		if i <= 0 || i == len(pair)-1 {
+			return nil, fmt.Errorf("Invalid target mapping %q: must be path=target", pair)
+		}
+		targets[pair[:i]] = pair[i+1:]
+	}
+	return targets, nil
+}
+
+// SplitList splits s at the separator sep, or at whitespace when sep is empty, dropping empty items.
+// Double quotes keep a separator inside an item, e.g. `"/mnt/my data" /tmp`; items are trimmed unless quoted.
+func SplitList(s string, sep rune) []string {
+	var items []string
+	var item strings.Builder
+	quoted, inQuotes := false, false
+	flush := func() {
+		value := item.String()
+		if !quoted {
+			value = strings.TrimSpace(value)
+		}
+		if value != "" {
+			items = append(items, value)
+		}
+		item.Reset()
+		quoted = false
+	}
+	for _, r := range s {
+		switch {
+		case r == '"':
+			inQuotes = !inQuotes
+			quoted = true
+		case !inQuotes && (r == sep || sep == 0 && unicode.IsSpace(r)):
+			flush()
+		default:
+			item.WriteRune(r)
+		}
+	}
+	flush()
+	return items
+}
+
+// ParseIgnoreList parses comma separated paths into a set of normalized paths, e.g. `/tmp/,/var/cache`
+func ParseIgnoreList(s string) map[string]bool {
+	ignored := make(map[string]bool)
+	for _, path := range strings.Split(s, ",") {
+		if path = strings.TrimSpace(path); path != "" {
+			ignored[normalizePath(path)] = true
+		}
+	}
+	return ignored
+}
+
+// diskByPath returns the name of the disk in disks at path, comparing them like -ignore does so that /srv/ is /srv
+func diskByPath(disks map[string]DiskConfig, path string) (string, bool) {
+	path = normalizePath(path)
+	for diskName := range disks {
+		if normalizePath(diskName) == path {
+			return diskName, true
+		}
+	}
+	return "", false
+}
+
+// normalizePath strips trailing slashes so that /tmp and /tmp/ are the same disk, keeping the root /
+func normalizePath(path string) string {
+	if trimmed := strings.TrimRight(path, "/"); trimmed != "" {
+		return trimmed
+	}
+	return path
+}
+
+// listFlag is a flag that can be repeated, collecting every value
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ", ")
+}
+
+func (l *listFlag) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// diskFlag is a flag that can be repeated, collecting disks given as path=threshold, e.g. /var=10
+type diskFlag map[string]DiskConfig
+
+func (d *diskFlag) String() string {
+	entries := make([]string, 0, len(*d))
+	for path, diskConfig := range *d {
+		entries = append(entries, path+"="+diskConfig.Threshold.String())
+	}
+	sort.Strings(entries)
+	return strings.Join(entries, " ")
+}
+
+func (d *diskFlag) Set(value string) error {
+	// Thresholds never contain =, so the last one separates the path from the threshold
+	i := strings.LastIndex(value, "=")
+	if i <= 0 {
+		return fmt.Errorf("Invalid disk %q: must be path=threshold, e.g. /var=10", value)
+	}
+	threshold, err := diskspace.ParseThreshold(value[i+1:])
+	if err != nil {
+		return err
+	}
+	if *d == nil {
+		*d = make(diskFlag)
+	}
+	(*d)[value[:i]] = DiskConfig{Threshold: threshold}
+	return nil
+}
+
+// labelFlag is a flag that can be repeated, collecting friendly names of disks given as path=label, e.g. /srv=App Data
+type labelFlag map[string]string
+
+func (l *labelFlag) String() string {
+	entries := make([]string, 0, len(*l))
+	for path, label := range *l {
+		entries = append(entries, path+"="+label)
+	}
+	sort.Strings(entries)
+	return strings.Join(entries, " ")
+}
+
+func (l *labelFlag) Set(value string) error {
+	// Labels are free text, so the first = separates the path from the label
+	path, label, ok := strings.Cut(value, "=")
+	if !ok || path == "" || strings.TrimSpace(label) == "" {
+		return fmt.Errorf("Invalid label %q: must be path=label, e.g. \"/srv/app/data=App Data\"", value)
+	}
+	if *l == nil {
+		*l = make(labelFlag)
+	}
+	(*l)[path] = strings.TrimSpace(label)
+	return nil
+}
+
+// ReadSecretFile returns the contents of the file at path without trailing whitespace, e.g. a mounted secret
+func ReadSecretFile(path string) (string, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	secret := strings.TrimRightFunc(string(contents), unicode.IsSpace)
+	if secret == "" {
+		return "", fmt.Errorf("%s is empty", path)
+	}
+	return secret, nil
+}
+
+// LoadEnvFile sets the KEY=VALUE pairs of the dotenv file at path as environment variables, leaving variables that
+// are already set alone. Blank lines and lines starting with # are skipped, values may be wrapped in quotes.
+func LoadEnvFile(path string) error {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	for i, line := range strings.Split(string(contents), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(strings.TrimPrefix(line, "export "), "=")
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if !ok || !isEnvKey(key) {
+			return fmt.Errorf("%s:%d: expected KEY=VALUE", path, i+1)
+		}
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		if _, set := os.LookupEnv(key); set {
+			continue
+		}
+		if err := os.Setenv(key, value); err != nil {
+			return fmt.Errorf("%s:%d: %v", path, i+1, err)
+		}
+	}
+	return nil
+}
+
+// isEnvKey reports whether key is a valid environment variable name of letters, digits and underscores
+func isEnvKey(key string) bool {
+	for i, r := range key {
+		if r != '_' && !(r >= 'A' && r <= 'Z') && !(r >= 'a' && r <= 'z') && !(i > 0 && r >= '0' && r <= '9') {
+			return false
+		}
+	}
+	return key != ""
+}
+
+// envFallback returns value, or the environment variable key when value is empty
+func envFallback(value string, key string) string {
+	if value == "" {
+		return os.Getenv(key)
+	}
+	return value
+}
+
+// settingSource is where resolveSetting found the value of a setting, in ascending precedence
+type settingSource int
+
+const (
+	sourceDefault settingSource = iota
+	sourceEnv
+	sourceFlag
+)
+
+// resolveSetting returns the value of the flag name of flags if it was passed, otherwise the environment variable key
+// if it is set and the default of the flag as a last resort
+func resolveSetting(flags *flag.FlagSet, name string, key string) (string, settingSource) {
+	passed := false
+	flags.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			passed = true
+		}
+	})
+	if passed {
+		return flags.Lookup(name).Value.String(), sourceFlag
+	}
+	if value, ok := os.LookupEnv(key); ok {
+		return value, sourceEnv
+	}
+	return flags.Lookup(name).DefValue, sourceDefault
+}
+
+// resolveDisks returns the disks to check and their settings. The disks of config take precedence, otherwise the
+// disk list and the thresholds each come from their flag, then DISKSPACE_DISKS and DISKSPACE_THRESHOLDS, then the
+// flag defaults. With repeated -d disks the default disk list isn't used.
+func resolveDisks(flags *flag.FlagSet, config Config, separator rune, repeated bool) (map[string]DiskConfig, error) {
+	diskData := make(map[string]DiskConfig)
+	if config.Disks != nil {
+		for diskName, diskConfig := range config.Disks {
+			diskData[diskName] = diskConfig
+		}
+		return diskData, nil
+	}
+	names, namesFrom := resolveSetting(flags, "disk", "DISKSPACE_DISKS")
+	if repeated && namesFrom == sourceDefault {
+		return diskData, nil
+	}
+	thresholds, _ := resolveSetting(flags, "threshold", "DISKSPACE_THRESHOLDS")
+	thresholdValues, err := MapStrToThreshold(SplitList(thresholds, separator))
+	if err != nil {
+		return nil, err
+	}
+
+	// A single threshold applies to every disk, otherwise there has to be one per disk
+	diskNames := SplitList(names, separator)
+	if len(thresholdValues) == 1 {
+		for len(thresholdValues) < len(diskNames) {
+			thresholdValues = append(thresholdValues, thresholdValues[0])
+		}
+	}
+	if len(diskNames) != len(thresholdValues) {
+		return nil, fmt.Errorf("-disk has %d values but -threshold has %d: pass one threshold per disk, or a single one for all disks", len(diskNames), len(thresholdValues))
+	}
+	for i, diskName := range diskNames {
+		diskData[diskName] = DiskConfig{Threshold: thresholdValues[i]}
+	}
+	return diskData, nil
+}
+
+// flagSet reports whether the flag name was passed on the command line
+func flagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/danthelion/diskspace2slack/diskspace"
+)
+
+// testFlags returns the disk, threshold and hostname flags of main with their defaults, parsed from args
+func testFlags(t *testing.T, args ...string) *flag.FlagSet {
+	flags := flag.NewFlagSet("diskspace2slack", flag.ContinueOnError)
+	flags.String("disk", "/ /tmp", "")
+	flags.String("threshold", "10 10", "")
+	flags.String("hostname", "", "")
+	if err := flags.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	return flags
+}
+
+// unsetenv unsets key for the rest of the test
+func unsetenv(t *testing.T, key string) {
+	t.Setenv(key, "")
+	os.Unsetenv(key)
+}
+
+func TestResolveSettingPrecedence(t *testing.T) {
+	tests := []struct {
+		name       string
+		args       []string
+		env        string
+		want       string
+		wantSource settingSource
+	}{
+		{"flag over env", []string{"-hostname", "flag"}, "env", "flag", sourceFlag},
+		{"env over default", nil, "env", "env", sourceEnv},
+		{"empty env over default", nil, "", "", sourceEnv},
+		{"default", nil, "-", "", sourceDefault},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.env == "-" {
+				unsetenv(t, "DISKSPACE_HOSTNAME")
+			} else {
+				t.Setenv("DISKSPACE_HOSTNAME", test.env)
+			}
+			got, source := resolveSetting(testFlags(t, test.args...), "hostname", "DISKSPACE_HOSTNAME")
+			if got != test.want || source != test.wantSource {
+				t.Errorf("resolveSetting() = %q from %d, want %q from %d", got, source, test.want, test.wantSource)
+			}
+		})
+	}
+}
+
+func TestResolveDisksPrecedence(t *testing.T) {
+	threshold := func(value uint64) diskspace.Threshold { return diskspace.Threshold{Value: value} }
+	config := Config{Disks: map[string]DiskConfig{
+		"/":    {Threshold: threshold(30), Target: "#ops"},
+		"/var": {Threshold: threshold(40)},
+	}}
+	tests := []struct {
+		name       string
+		args       []string
+		disks      string
+		thresholds string
+		config     Config
+		repeated   bool
+		want       map[string]DiskConfig
+	}{
+		{
+			name: "defaults",
+			want: map[string]DiskConfig{"/": {Threshold: threshold(10)}, "/tmp": {Threshold: threshold(10)}},
+		},
+		{
+			name:       "env over defaults",
+			disks:      "/var /srv",
+			thresholds: "20",
+			want:       map[string]DiskConfig{"/var": {Threshold: threshold(20)}, "/srv": {Threshold: threshold(20)}},
+		},
+		{
+			name:       "flags over env",
+			args:       []string{"-disk", "/", "-threshold", "5"},
+			disks:      "/var",
+			thresholds: "20",
+			want:       map[string]DiskConfig{"/": {Threshold: threshold(5)}},
+		},
+		{
+			name:       "flag disks with env thresholds",
+			args:       []string{"-disk", "/ /srv"},
+			thresholds: "15",
+			want:       map[string]DiskConfig{"/": {Threshold: threshold(15)}, "/srv": {Threshold: threshold(15)}},
+		},
+		{
+			name:       "config over env",
+			disks:      "/srv",
+			thresholds: "10 10",
+			config:     config,
+			want:       config.Disks,
+		},
+		{
+			name:   "config over flags",
+			args:   []string{"-disk", "/srv", "-threshold", "5"},
+			config: config,
+			want:   config.Disks,
+		},
+		{
+			name:     "repeated disks without -disk",
+			repeated: true,
+			want:     map[string]DiskConfig{},
+		},
+		{
+			name:       "repeated disks with env disks",
+			disks:      "/srv",
+			thresholds: "10",
+			repeated:   true,
+			want:       map[string]DiskConfig{"/srv": {Threshold: threshold(10)}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for key, value := range map[string]string{"DISKSPACE_DISKS": test.disks, "DISKSPACE_THRESHOLDS": test.thresholds} {
+				if value == "" {
+					unsetenv(t, key)
+				} else {
+					t.Setenv(key, value)
+				}
+			}
+			got, err := resolveDisks(testFlags(t, test.args...), test.config, 0, test.repeated)
+			if err != nil {
+				t.Fatalf("resolveDisks() failed: %v", err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("resolveDisks() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestDiskByPath(t *testing.T) {
+	disks := map[string]DiskConfig{"/": {}, "/srv": {}, "/var/log/": {}, "deploy@web1:/data": {}}
+	tests := []struct {
+		path string
+		want string
+		ok   bool
+	}{
+		{"/", "/", true},
+		{"/srv/", "/srv", true},
+		{"/var/log", "/var/log/", true},
+		{"deploy@web1:/data/", "deploy@web1:/data", true},
+		{"/srv/app", "", false},
+		{"/svr", "", false},
+	}
+	for _, test := range tests {
+		if got, ok := diskByPath(disks, test.path); got != test.want || ok != test.ok {
+			t.Errorf("diskByPath(%q) = %q, %v, want %q, %v", test.path, got, ok, test.want, test.ok)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Cooldown suppresses alerts for a disk that alerted less than Duration ago, keyed by target and host:path so that
+// the copies of an alert for the targets of paths folded into the disk have cooldowns of their own.
+// Recoveries and OK reports always pass, and so do escalations, e.g. from warning to danger, which restart the cooldown.
+type Cooldown struct {
+	Duration time.Duration
+
+	mu   sync.Mutex
+	last map[string]cooldownState
+}
+
+// cooldownState is when a disk last passed the Cooldown and with which severity
+type cooldownState struct {
+	time     time.Time
+	severity string
+}
+
+// Allow reports whether alert is outside the cooldown of its disk or escalates it, starting a new cooldown if so
+func (c *Cooldown) Allow(alert Alert) bool {
+	if alert.Recovered || alert.OK || c.Duration <= 0 {
+		return true
+	}
+	severity := Severity(alert, alert.Critical)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := alert.Target + " " + alert.Disk.Host + ":" + alert.Disk.Name
+	if last, ok := c.last[key]; ok && time.Since(last.time) < c.Duration && severityRank[severity] <= severityRank[last.severity] {
+		return false
+	}
+	if c.last == nil {
+		c.last = make(map[string]cooldownState)
+	}
+	c.last[key] = cooldownState{time: time.Now(), severity: severity}
+	return true
+}
+
+// NamedNotifier is a Notifier along with its -notifier name
+type NamedNotifier struct {
+	Name     string
+	Notifier Notifier
+	// IgnoreCooldown delivers every alert to Notifier, even while its disk is in cooldown
+	IgnoreCooldown bool
+}
+
+// MultiNotifier delivers every alert to all of Notifiers. Cooldown is decided once per alert,
+// so that a disk in cooldown is suppressed for every notifier that doesn't ignore it.
+type MultiNotifier struct {
+	Notifiers []NamedNotifier
+	Cooldown  *Cooldown
+	// StopOnError skips the remaining notifiers of an alert once one of them failed
+	StopOnError bool
+}
+
+// Notify sends alert to every notifier, returning the errors of the failed ones
+func (m *MultiNotifier) Notify(ctx context.Context, alert Alert) error {
+	allowed := m.Cooldown.Allow(alert)
+	var errs []error
+	for _, named := range m.Notifiers {
+		if !allowed && !named.IgnoreCooldown {
+			slog.Debug("Skipping alert in cooldown", append(alert.LogAttrs(), "notifier", named.Name)...)
+			continue
+		}
+		if err := named.Notifier.Notify(ctx, alert); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", named.Name, err))
+			if m.StopOnError {
+				break
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// NotifyBatch sends the alerts for target to every notifier, as one message to the ones that are BatchNotifiers
+func (m *MultiNotifier) NotifyBatch(ctx context.Context, target string, alerts []Alert) error {
+	allowed := make([]bool, len(alerts))
+	for i, alert := range alerts {
+		allowed[i] = m.Cooldown.Allow(alert)
+	}
+	var errs []error
+	for _, named := range m.Notifiers {
+		var notifierAlerts []Alert
+		for i, alert := range alerts {
+			if allowed[i] || named.IgnoreCooldown {
+				notifierAlerts = append(notifierAlerts, alert)
+			}
+		}
+		if len(notifierAlerts) == 0 {
+			continue
+		}
+		if batchNotifier, ok := named.Notifier.(BatchNotifier); ok {
+			if err := batchNotifier.NotifyBatch(ctx, target, notifierAlerts); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", named.Name, err))
+			}
+		} else {
+			for _, alert := range notifierAlerts {
+				if err := named.Notifier.Notify(ctx, alert); err != nil {
+					errs = append(errs, fmt.Errorf("%s: %w", named.Name, err))
+					if m.StopOnError {
+						break
+					}
+				}
+			}
+		}
+		if m.StopOnError && len(errs) > 0 {
+			break
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// NotifySummary sends summary to every notifier regardless of Cooldown, all of them have to be SummaryNotifiers
+func (m *MultiNotifier) NotifySummary(ctx context.Context, target string, summary RunSummary) error {
+	var errs []error
+	for _, named := range m.Notifiers {
+		summaryNotifier, ok := named.Notifier.(SummaryNotifier)
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: summaries not supported", named.Name))
+			continue
+		}
+		if err := summaryNotifier.NotifySummary(ctx, target, summary); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", named.Name, err))
+			if m.StopOnError {
+				break
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Verify checks every notifier that is a Verifier, failing on the first one that doesn't pass
+func (m *MultiNotifier) Verify(ctx context.Context) (string, error) {
+	var statuses []string
+	for _, named := range m.Notifiers {
+		verifier, ok := named.Notifier.(Verifier)
+		if !ok {
+			continue
+		}
+		status, err := verifier.Verify(ctx)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", named.Name, err)
+		}
+		statuses = append(statuses, named.Name+": "+status)
+	}
+	if len(statuses) == 0 {
+		return "nothing to verify", nil
+	}
+	return strings.Join(statuses, ", "), nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/danthelion/diskspace2slack/diskspace"
+)
+
+func TestCooldownEscalation(t *testing.T) {
+	cooldown := &Cooldown{Duration: time.Hour}
+	alert := func(free uint64) Alert {
+		return Alert{Disk: testDisk("/", 100, free), Threshold: diskspace.Threshold{Value: 20}, Critical: 5}
+	}
+	for _, step := range []struct {
+		free    uint64
+		allowed bool
+	}{
+		{15, true},  // warning
+		{10, false}, // still warning
+		{3, true},   // critical
+		{2, false},  // still critical
+		{10, false}, // back to warning
+	} {
+		if allowed := cooldown.Allow(alert(step.free)); allowed != step.allowed {
+			t.Errorf("%d%% free: Allow() = %v, want %v", step.free, allowed, step.allowed)
+		}
+	}
+	if recovered := alert(50); !cooldown.Allow(Alert{Disk: recovered.Disk, Recovered: true}) {
+		t.Error("Allow() held back a recovery")
+	}
+}
+
+// TestMultiNotifierCooldownEscalation delivers a disk turning critical to every notifier while it is in cooldown
+func TestMultiNotifierCooldownEscalation(t *testing.T) {
+	first, second := &recordingNotifier{}, &recordingNotifier{}
+	multi := &MultiNotifier{
+		Notifiers: []NamedNotifier{{Name: "first", Notifier: first}, {Name: "second", Notifier: second}},
+		Cooldown:  &Cooldown{Duration: time.Hour},
+	}
+	for _, free := range []uint64{15, 10, 3} {
+		alert := Alert{Disk: testDisk("/", 100, free), Threshold: diskspace.Threshold{Value: 20}, Critical: 5}
+		if err := multi.Notify(context.Background(), alert); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, notifier := range []*recordingNotifier{first, second} {
+		if len(notifier.alerts) != 2 || notifier.alerts[1].Disk.FreePercentage != 3 {
+			t.Errorf("notified %d times, want the warning and the critical alert", len(notifier.alerts))
+		}
+	}
+}
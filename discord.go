@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/danthelion/diskspace2slack/diskspace"
+)
+
+// discordAttempts is how often a post is tried while Discord is rate limiting
+const discordAttempts = 3
+
+// DiscordNotifier posts alerts as embeds to a Discord webhook.
+// Disks below the critical level of their threshold, or Critical percent, are colored as critical instead of warning.
+// Posts that take longer than Timeout, or defaultHTTPTimeout if it is zero, are aborted.
+type DiscordNotifier struct {
+	WebhookURL string
+	Critical   uint64
+	Timeout    time.Duration
+}
+
+// discordColors are the embed colors by Severity
+var discordColors = map[string]int{
+	"danger":  0xD00000,
+	"warning": 0xFFA500,
+	"good":    0x2EB886,
+}
+
+// discordMessage is the JSON payload accepted by Discord webhooks
+type discordMessage struct {
+	Embeds []discordEmbed `json:"embeds"`
+}
+
+// discordEmbed is a single embed of a discordMessage
+type discordEmbed struct {
+	Title  string              `json:"title"`
+	Color  int                 `json:"color"`
+	Fields []discordEmbedField `json:"fields"`
+}
+
+// discordEmbedField is a name/value pair of a discordEmbed
+type discordEmbedField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline"`
+}
+
+// discordRateLimit is the body of a 429 response
+type discordRateLimit struct {
+	// RetryAfter is the delay in seconds
+	RetryAfter float64 `json:"retry_after"`
+}
+
+// embed renders alert as an embed colored by severity
+func (n *DiscordNotifier) embed(alert Alert) discordEmbed {
+	disk := alert.Disk
+	color := Severity(alert, n.Critical)
+	title := fmt.Sprintf("%s on %s:%s", alert.Problem(), disk.Host, disk.Name)
+	if alert.Recovered {
+		color = "good"
+		title = fmt.Sprintf("Disk space recovered on %s:%s", disk.Host, disk.Name)
+	}
+	return discordEmbed{
+		Title: title,
+		Color: discordColors[color],
+		Fields: []discordEmbedField{
+			{Name: "Total", Value: diskspace.FormatBytes(disk.All), Inline: true},
+			{Name: "Free", Value: diskspace.FormatBytes(disk.Free), Inline: true},
+			{Name: "Used", Value: diskspace.FormatBytes(disk.Used), Inline: true},
+			{Name: "Free %", Value: fmt.Sprintf("%d%%", disk.FreePercentage), Inline: true},
+			{Name: "Used %", Value: fmt.Sprintf("%d%%", disk.UsedPercentage), Inline: true},
+			{Name: "Threshold", Value: alert.Threshold.String(), Inline: true},
+		},
+	}
+}
+
+// Notify posts alert to the webhook, waiting as long as Discord asks for when rate limited
+func (n *DiscordNotifier) Notify(ctx context.Context, alert Alert) error {
+	payload, err := json.Marshal(discordMessage{Embeds: []discordEmbed{n.embed(alert)}})
+	if err != nil {
+		return err
+	}
+	for attempt := 1; ; attempt++ {
+		retryAfter, err := n.post(ctx, payload)
+		if err == nil {
+			logRoutine("Message sent to Discord", alert.LogAttrs()...)
+			return nil
+		}
+		if retryAfter == 0 || attempt >= discordAttempts {
+			return err
+		}
+		slog.Warn("Discord is rate limiting, retrying", append(alert.LogAttrs(), "attempt", attempt, "retry_in", retryAfter.String())...)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(retryAfter):
+		}
+	}
+}
+
+// post sends payload to the webhook once, returning the delay Discord asked for when rate limited
+func (n *DiscordNotifier) post(ctx context.Context, payload []byte) (time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.WebhookURL, bytes.NewReader(payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := timeoutClient(n.Timeout).Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+		return 0, nil
+	}
+	body, _ := io.ReadAll(resp.Body)
+	err = fmt.Errorf("Discord returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	if resp.StatusCode != http.StatusTooManyRequests {
+		return 0, err
+	}
+	// The body carries the delay in seconds with a fraction, the header only whole seconds
+	rateLimit := discordRateLimit{}
+	if json.Unmarshal(body, &rateLimit) == nil && rateLimit.RetryAfter > 0 {
+		return time.Duration(rateLimit.RetryAfter * float64(time.Second)), err
+	}
+	if seconds, parseErr := strconv.Atoi(resp.Header.Get("Retry-After")); parseErr == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second, err
+	}
+	return time.Second, err
+}
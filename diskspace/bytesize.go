@@ -0,0 +1,235 @@
+package diskspace
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const (
+	BYTE     = 1.0
+	KILOBYTE = 1024 * BYTE
+	MEGABYTE = 1024 * KILOBYTE
+	GIGABYTE = 1024 * MEGABYTE
+	TERABYTE = 1024 * GIGABYTE
+	PETABYTE = 1024 * TERABYTE
+	// EXABYTE is the largest unit that fits into uint64, which tops out at 16EB
+	EXABYTE = 1024 * PETABYTE
+)
+
+// Decimal (SI) units used by ByteSizeSI
+const (
+	KILOBYTE_SI = 1000 * BYTE
+	MEGABYTE_SI = 1000 * KILOBYTE_SI
+	GIGABYTE_SI = 1000 * MEGABYTE_SI
+	TERABYTE_SI = 1000 * GIGABYTE_SI
+	PETABYTE_SI = 1000 * TERABYTE_SI
+	EXABYTE_SI  = 1000 * PETABYTE_SI
+)
+
+// ZeroBytes is what ByteSize and its variants return for zero bytes, set it to "0" for the bare number of older versions
+var ZeroBytes = "0B"
+
+// FormatBytes formats the byte counts in reports, ByteSize by default. Set it to one of its variants to change the units.
+var FormatBytes = ByteSize
+
+// ByteSize returns a human-readable byte string of the form 10M, 12.5K, and so forth.
+// The unit that results in the smallest number greater than or equal to 1 is always chosen.
+func ByteSize(bytes uint64) string {
+	return ByteSizePrec(bytes, 1)
+}
+
+// ByteSizePrec is like ByteSize but formats the value with prec decimal places.
+// Trailing zeros of the decimal places are trimmed, so 10.50M becomes 10.5M and 10.00M becomes 10M.
+func ByteSizePrec(bytes uint64, prec int) string {
+	unit := ""
+	value := float32(bytes)
+	switch {
+	case bytes >= EXABYTE:
+		unit = "EB"
+		value = value / EXABYTE
+	case bytes >= PETABYTE:
+		unit = "PB"
+		value = value / PETABYTE
+	case bytes >= TERABYTE:
+		unit = "TB"
+		value = value / TERABYTE
+	case bytes >= GIGABYTE:
+		unit = "GB"
+		value = value / GIGABYTE
+	case bytes >= MEGABYTE:
+		unit = "MB"
+		value = value / MEGABYTE
+	case bytes >= KILOBYTE:
+		unit = "KB"
+		value = value / KILOBYTE
+	case bytes >= BYTE:
+		unit = "B"
+	case bytes == 0:
+		return ZeroBytes
+	}
+	value, unit = roundUpUnit(value, unit, prec, KILOBYTE, iecUnits)
+	return formatByteValue(value, unit, prec)
+}
+
+// ByteSizeSI is like ByteSize but uses decimal units, i.e. powers of 1000 labeled kB, MB, GB, TB and so forth
+func ByteSizeSI(bytes uint64) string {
+	unit := ""
+	value := float32(bytes)
+	switch {
+	case bytes >= EXABYTE_SI:
+		unit = "EB"
+		value = value / EXABYTE_SI
+	case bytes >= PETABYTE_SI:
+		unit = "PB"
+		value = value / PETABYTE_SI
+	case bytes >= TERABYTE_SI:
+		unit = "TB"
+		value = value / TERABYTE_SI
+	case bytes >= GIGABYTE_SI:
+		unit = "GB"
+		value = value / GIGABYTE_SI
+	case bytes >= MEGABYTE_SI:
+		unit = "MB"
+		value = value / MEGABYTE_SI
+	case bytes >= KILOBYTE_SI:
+		unit = "kB"
+		value = value / KILOBYTE_SI
+	case bytes >= BYTE:
+		unit = "B"
+	case bytes == 0:
+		return ZeroBytes
+	}
+	value, unit = roundUpUnit(value, unit, 1, KILOBYTE_SI, siUnits)
+	return formatByteValue(value, unit, 1)
+}
+
+// Units of ByteSize and ByteSizeSI in ascending order
+var (
+	iecUnits = []string{"B", "KB", "MB", "GB", "TB", "PB", "EB"}
+	siUnits  = []string{"B", "kB", "MB", "GB", "TB", "PB", "EB"}
+)
+
+// roundUpUnit re-expresses value in the next larger unit if it reaches base once rounded to prec decimal places,
+// so that e.g. 1023.99MB is shown as 1GB instead of 1024MB
+func roundUpUnit(value float32, unit string, prec int, base float32, units []string) (float32, string) {
+	var buf [32]byte
+	rounded, _ := strconv.ParseFloat(string(strconv.AppendFloat(buf[:0], float64(value), 'f', prec, 32)), 32)
+	if float32(rounded) < base {
+		return value, unit
+	}
+	for i := 0; i < len(units)-1; i++ {
+		if units[i] == unit {
+			return value / base, units[i+1]
+		}
+	}
+	return value, unit
+}
+
+// ByteSizeLong is like ByteSize but separates value and unit by a space, e.g. 10 MB or 1.5 GB
+func ByteSizeLong(bytes uint64) string {
+	return spaceUnit(ByteSize(bytes))
+}
+
+// ByteSizeSILong is like ByteSizeSI but separates value and unit by a space, e.g. 10 MB or 1.5 kB
+func ByteSizeSILong(bytes uint64) string {
+	return spaceUnit(ByteSizeSI(bytes))
+}
+
+// ThousandsSeparator groups the integer part of the long formats, e.g. 1,020 MB. Set it to "." or " " for locales
+// that use those, or to "" to leave values ungrouped. With "." the decimal mark becomes ",", e.g. 1.020,5 MB.
+// Only integer parts of 1000 and above are grouped, which with the 1024-based units of ByteSize are 1000 to 1023.
+var ThousandsSeparator = ","
+
+// spaceUnit inserts a space between the value and the unit of a formatted byte size, grouping the value's thousands
+func spaceUnit(size string) string {
+	if i := strings.IndexFunc(size, unicode.IsLetter); i > 0 {
+		return groupThousands(size[:i], ThousandsSeparator) + " " + size[i:]
+	}
+	return size
+}
+
+// groupThousands inserts separator between every three digits of the integer part of number.
+// A "." separator turns the decimal mark into "," so that grouped and fractional digits can be told apart.
+func groupThousands(number string, separator string) string {
+	integer, fraction := number, ""
+	if i := strings.IndexByte(number, '.'); i >= 0 {
+		integer, fraction = number[:i], number[i:]
+		if separator == "." {
+			fraction = "," + fraction[1:]
+		}
+	}
+	if separator == "" || len(integer) <= 3 {
+		return integer + fraction
+	}
+	var grouped strings.Builder
+	for i, digit := range integer {
+		if i > 0 && (len(integer)-i)%3 == 0 {
+			grouped.WriteString(separator)
+		}
+		grouped.WriteRune(digit)
+	}
+	return grouped.String() + fraction
+}
+
+// formatByteValue formats value with prec decimal places, trimming trailing zeros, followed by unit.
+// It formats into a stack buffer so that the returned string is the only allocation.
+func formatByteValue(value float32, unit string, prec int) string {
+	var buf [32]byte
+	formatted := strconv.AppendFloat(buf[:0], float64(value), 'f', prec, 32)
+	if prec > 0 {
+		for len(formatted) > 0 && formatted[len(formatted)-1] == '0' {
+			formatted = formatted[:len(formatted)-1]
+		}
+		if len(formatted) > 0 && formatted[len(formatted)-1] == '.' {
+			formatted = formatted[:len(formatted)-1]
+		}
+	}
+	return string(append(formatted, unit...))
+}
+
+// ParseByteSize converts a human-readable byte string like 10M, 1.5GB, 512k or 1024 back into bytes.
+// Units are case-insensitive and may be written with or without the trailing B.
+func ParseByteSize(s string) (uint64, error) {
+	upper := strings.ToUpper(strings.TrimSpace(s))
+	if upper == "" {
+		return 0, errors.New("Invalid byte size: empty string")
+	}
+	number, unit := upper, ""
+	if i := strings.IndexFunc(upper, func(r rune) bool { return (r < '0' || r > '9') && r != '.' }); i >= 0 {
+		number, unit = upper[:i], upper[i:]
+	}
+
+	var multiplier float64
+	switch strings.TrimSuffix(unit, "B") {
+	case "":
+		multiplier = BYTE
+	case "K":
+		multiplier = KILOBYTE
+	case "M":
+		multiplier = MEGABYTE
+	case "G":
+		multiplier = GIGABYTE
+	case "T":
+		multiplier = TERABYTE
+	case "P":
+		multiplier = PETABYTE
+	case "E":
+		multiplier = EXABYTE
+	default:
+		return 0, fmt.Errorf("Invalid byte size %q: unknown unit %q", s, unit)
+	}
+
+	value, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid byte size %q: %q is not a number", s, number)
+	}
+	bytes := value * multiplier
+	if bytes >= math.MaxUint64 {
+		return 0, fmt.Errorf("Invalid byte size %q: too large", s)
+	}
+	return uint64(bytes), nil
+}
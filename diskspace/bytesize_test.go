@@ -0,0 +1,152 @@
+package diskspace
+
+import (
+	"math"
+	"testing"
+)
+
+func TestByteSize(t *testing.T) {
+	tests := []struct {
+		bytes uint64
+		want  string
+	}{
+		{1, "1B"},
+		{1023, "1023B"},
+		{KILOBYTE, "1KB"},
+		{KILOBYTE + 512, "1.5KB"},
+		{MEGABYTE - 1, "1MB"},
+		{MEGABYTE, "1MB"},
+		{GIGABYTE - 1, "1GB"},
+		{GIGABYTE, "1GB"},
+		{TERABYTE - 1, "1TB"},
+		{TERABYTE, "1TB"},
+		{PETABYTE - 1, "1PB"},
+		{PETABYTE, "1PB"},
+		{EXABYTE - 1, "1EB"},
+		{EXABYTE, "1EB"},
+		{math.MaxUint64, "16EB"},
+	}
+	for _, test := range tests {
+		if got := ByteSize(test.bytes); got != test.want {
+			t.Errorf("ByteSize(%d) = %q, want %q", test.bytes, got, test.want)
+		}
+	}
+}
+
+// TestByteSizeAllocs pins ByteSize to a single allocation, the returned string
+func TestByteSizeAllocs(t *testing.T) {
+	if allocs := testing.AllocsPerRun(100, func() { ByteSize(1536 * MEGABYTE) }); allocs > 1 {
+		t.Errorf("ByteSize() allocates %v times, want 1", allocs)
+	}
+}
+
+func BenchmarkByteSize(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		ByteSize(1536 * MEGABYTE)
+	}
+}
+
+// TestByteSizeSI formats the same byte count in both units, which differ above 1000 bytes
+func TestByteSizeSI(t *testing.T) {
+	tests := []struct {
+		bytes   uint64
+		iec, si string
+	}{
+		{1000000, "976.6KB", "1MB"},
+		{1000, "1000B", "1kB"},
+		{1500, "1.5KB", "1.5kB"},
+		{1000000000, "953.7MB", "1GB"},
+	}
+	for _, test := range tests {
+		if got := ByteSize(test.bytes); got != test.iec {
+			t.Errorf("ByteSize(%d) = %q, want %q", test.bytes, got, test.iec)
+		}
+		if got := ByteSizeSI(test.bytes); got != test.si {
+			t.Errorf("ByteSizeSI(%d) = %q, want %q", test.bytes, got, test.si)
+		}
+	}
+}
+
+// TestZeroBytes tells "0B" from the bare "0" of older versions in every format
+func TestZeroBytes(t *testing.T) {
+	defer func(zero string) { ZeroBytes = zero }(ZeroBytes)
+	tests := []struct {
+		zero  string
+		short string
+		long  string
+	}{
+		{"0B", "0B", "0 B"},
+		{"0", "0", "0"},
+	}
+	for _, test := range tests {
+		ZeroBytes = test.zero
+		for _, got := range []string{ByteSize(0), ByteSizeSI(0), ByteSizePrec(0, 2)} {
+			if got != test.short {
+				t.Errorf("ZeroBytes %q: formatted zero as %q, want %q", test.zero, got, test.short)
+			}
+		}
+		for _, got := range []string{ByteSizeLong(0), ByteSizeSILong(0)} {
+			if got != test.long {
+				t.Errorf("ZeroBytes %q: formatted zero as %q, want %q", test.zero, got, test.long)
+			}
+		}
+	}
+}
+
+// TestByteSizeRollover pins the values around each base, where values that round up to it roll over to the next unit
+func TestByteSizeRollover(t *testing.T) {
+	tests := []struct {
+		format func(uint64) string
+		name   string
+		bytes  uint64
+		want   string
+	}{
+		{ByteSize, "ByteSize", 1023, "1023B"},
+		{ByteSize, "ByteSize", 1024, "1KB"},
+		{ByteSize, "ByteSize", 1023*KILOBYTE + 512, "1023.5KB"},
+		{ByteSize, "ByteSize", 1023*KILOBYTE + 972, "1023.9KB"},
+		{ByteSize, "ByteSize", 1023*KILOBYTE + 973, "1MB"},
+		{ByteSize, "ByteSize", MEGABYTE - 1, "1MB"},
+		{ByteSize, "ByteSize", MEGABYTE + 52429, "1.1MB"},
+		{ByteSizeSI, "ByteSizeSI", 999, "999B"},
+		{ByteSizeSI, "ByteSizeSI", 1000, "1kB"},
+		{ByteSizeSI, "ByteSizeSI", 999900, "999.9kB"},
+		{ByteSizeSI, "ByteSizeSI", 999950, "1MB"},
+		{ByteSizeSI, "ByteSizeSI", 1000000, "1MB"},
+	}
+	for _, test := range tests {
+		if got := test.format(test.bytes); got != test.want {
+			t.Errorf("%s(%d) = %q, want %q", test.name, test.bytes, got, test.want)
+		}
+	}
+}
+
+func TestByteSizeLongGrouping(t *testing.T) {
+	defer func(separator string) { ThousandsSeparator = separator }(ThousandsSeparator)
+	tests := []struct {
+		separator string
+		format    func(uint64) string
+		bytes     uint64
+		want      string
+	}{
+		// With 1024-based units only integer parts of 1000 to 1023 are grouped
+		{",", ByteSizeLong, 999 * MEGABYTE, "999 MB"},
+		{",", ByteSizeLong, 1000 * MEGABYTE, "1,000 MB"},
+		{",", ByteSizeLong, 1020*MEGABYTE + MEGABYTE/2, "1,020.5 MB"},
+		{",", ByteSizeLong, 1023 * MEGABYTE, "1,023 MB"},
+		{",", ByteSizeLong, 1024 * MEGABYTE, "1 GB"},
+		{",", ByteSizeSILong, 999500, "999.5 kB"},
+		// "." turns the decimal mark into ",", so that 1.020,5 can't be mistaken for 1.0205
+		{".", ByteSizeLong, 1020*MEGABYTE + MEGABYTE/2, "1.020,5 MB"},
+		{".", ByteSizeLong, MEGABYTE + MEGABYTE/2, "1,5 MB"},
+		{" ", ByteSizeLong, 1020*MEGABYTE + MEGABYTE/2, "1 020.5 MB"},
+		{"", ByteSizeLong, 1020*MEGABYTE + MEGABYTE/2, "1020.5 MB"},
+	}
+	for _, test := range tests {
+		ThousandsSeparator = test.separator
+		if got := test.format(test.bytes); got != test.want {
+			t.Errorf("separator %q: formatted %d as %q, want %q", test.separator, test.bytes, got, test.want)
+		}
+	}
+}
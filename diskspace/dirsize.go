@@ -0,0 +1,58 @@
+package diskspace
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path/filepath"
+)
+
+// MeasureDir stats the filesystem of the local directory path like StatDisk and sums the sizes of all files below it
+// into DirSize. Entries that can't be read due to missing permissions are skipped and counted in DirSkipped.
+func MeasureDir(path string) (DiskState, error) {
+	if _, _, remote := SplitRemoteDisk(path); remote {
+		return DiskState{}, fmt.Errorf("Couldn't measure %s: directories can only be measured locally", path)
+	}
+	disk, err := StatDisk(path)
+	if err != nil {
+		return DiskState{}, err
+	}
+	disk.Directory = true
+	err = filepath.WalkDir(disk.RealPath, func(entryPath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			// The root itself has to be readable, anything below it is skipped or gone by now
+			if entryPath == disk.RealPath {
+				return err
+			}
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			if !errors.Is(err, fs.ErrPermission) {
+				return err
+			}
+			slog.Debug("Skipping unreadable entry", "path", entryPath, "error", err)
+			disk.DirSkipped++
+			if entry != nil && entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		disk.DirSize += uint64(info.Size())
+		return nil
+	})
+	if err != nil {
+		return DiskState{}, fmt.Errorf("Couldn't measure directory %s: %v", path, err)
+	}
+	return disk, nil
+}
@@ -0,0 +1,96 @@
+// Package diskspace measures the free space of local and remote disks and renders reports about it.
+// It is the core of diskspace2slack and has no dependency on any notification backend.
+package diskspace
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"path/filepath"
+)
+
+// DiskState represents available/used/free space and inodes on drive.
+// Free is the space available to unprivileged users, FreeTotal additionally includes the blocks reserved for root,
+// so All = Used + FreeTotal.
+type DiskState struct {
+	Host                 string `json:"host"`
+	Name                 string `json:"name"`
+	RealPath             string `json:"real_path,omitempty"`
+	MountPoint           string `json:"mount_point"`
+	FSType               string `json:"fs_type"`
+	All                  uint64 `json:"all"`
+	Used                 uint64 `json:"used"`
+	Free                 uint64 `json:"free"`
+	FreeTotal            uint64 `json:"free_total"`
+	FreePercentage       uint64 `json:"free_percentage"`
+	UsedPercentage       uint64 `json:"used_percentage"`
+	InodesAll            uint64 `json:"inodes_all"`
+	InodesFree           uint64 `json:"inodes_free"`
+	InodesFreePercentage uint64 `json:"inodes_free_percentage"`
+	// Directory is set by MeasureDir, where the size of the files below the path in DirSize is checked
+	// instead of the free space. DirSkipped counts the entries that couldn't be read.
+	Directory  bool   `json:"directory,omitempty"`
+	DirSize    uint64 `json:"dir_size,omitempty"`
+	DirSkipped int    `json:"dir_skipped,omitempty"`
+	// ReadOnly is set for local filesystems mounted read-only, it is never set on Windows or for remote disks
+	ReadOnly bool `json:"read_only"`
+	// Device identifies the filesystem of local disks, 0 if unknown
+	Device uint64 `json:"-"`
+	// Aliases are the other checked paths on the same filesystem, which are reported as this disk
+	Aliases []string `json:"aliases,omitempty"`
+	// DisplayName is the friendly name of the disk shown along with Name in reports, empty unless configured
+	DisplayName string `json:"display_name,omitempty"`
+}
+
+// DiskStateJSON encodes disk as a JSON object, byte counts are kept raw
+func DiskStateJSON(disk DiskState) ([]byte, error) {
+	return json.Marshal(disk)
+}
+
+// StatDisk calculates the disk usage of path/disk, leaving Host to the caller.
+// Symlinks are followed, the path that was actually measured is stored as RealPath.
+func StatDisk(path string) (DiskState, error) {
+	realPath, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return DiskState{}, fmt.Errorf("Couldn't resolve path %s: %v", path, err)
+	}
+	localDisk, err := statDisk(realPath)
+	if err != nil {
+		return DiskState{}, errors.New("Couldn't stat path " + path)
+	}
+	localDisk.Used = localDisk.All - localDisk.FreeTotal
+	setPercentages(&localDisk)
+	// Filesystems without a fixed inode table (e.g. btrfs) report zero inodes, treat them as all free
+	localDisk.InodesFreePercentage = 100
+	if localDisk.InodesAll > 0 {
+		localDisk.InodesFreePercentage = uint64(float32(localDisk.InodesFree) / float32(localDisk.InodesAll) * 100)
+	}
+	localDisk.Name = path
+	localDisk.RealPath = realPath
+	localDisk.MountPoint, localDisk.FSType = MountOf(realPath)
+	return localDisk, nil
+}
+
+// PercentageBasis is the size FreePercentage and UsedPercentage are relative to, total (the default) or df
+var PercentageBasis = "total"
+
+// setPercentages fills in FreePercentage and UsedPercentage of disk according to PercentageBasis.
+// total divides Free and Used by All, so the blocks reserved for root count towards neither.
+// df divides by Used + Free like df does, leaving the reserved blocks out, and rounds the used percentage up like df.
+// Pseudo-filesystems (e.g. proc, sysfs) report zero blocks and can't fill up, they are treated as all free.
+func setPercentages(disk *DiskState) {
+	disk.FreePercentage = 100
+	disk.UsedPercentage = 0
+	if PercentageBasis == "df" {
+		if usable := disk.Used + disk.Free; usable > 0 {
+			disk.UsedPercentage = uint64(math.Ceil(float64(disk.Used) / float64(usable) * 100))
+			disk.FreePercentage = 100 - disk.UsedPercentage
+		}
+		return
+	}
+	if disk.All > 0 {
+		disk.FreePercentage = uint64(float32(disk.Free) / float32(disk.All) * 100)
+		disk.UsedPercentage = uint64(float32(disk.Used) / float32(disk.All) * 100)
+	}
+}
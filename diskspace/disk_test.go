@@ -0,0 +1,44 @@
+package diskspace
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// TestSetPercentagesZeroTotal fills in the percentages of filesystems without blocks, which must neither divide by
+// zero nor be reported as full
+func TestSetPercentagesZeroTotal(t *testing.T) {
+	defer func(basis string) { PercentageBasis = basis }(PercentageBasis)
+	for _, basis := range []string{"total", "df"} {
+		PercentageBasis = basis
+		disk := DiskState{InodesFreePercentage: 100}
+		setPercentages(&disk)
+		if disk.FreePercentage != 100 || disk.UsedPercentage != 0 {
+			t.Errorf("%s: setPercentages() = %d%% free, %d%% used, want 100 and 0", basis, disk.FreePercentage, disk.UsedPercentage)
+		}
+		if (Threshold{Value: 10}).Breached(disk) {
+			t.Errorf("%s: an empty filesystem breaches a 10%% threshold", basis)
+		}
+	}
+}
+
+// TestStatDiskRoot stats the root filesystem of the machine running the tests
+func TestStatDiskRoot(t *testing.T) {
+	root := "/"
+	switch runtime.GOOS {
+	case "linux", "darwin", "freebsd", "openbsd", "dragonfly":
+	case "windows":
+		root = filepath.VolumeName(os.TempDir()) + `\`
+	default:
+		t.Skipf("Disk stats aren't supported on %s", runtime.GOOS)
+	}
+	disk, err := StatDisk(root)
+	if err != nil {
+		t.Fatalf("StatDisk(%q) failed: %v", root, err)
+	}
+	if disk.All == 0 || disk.Free > disk.All {
+		t.Errorf("StatDisk(%q) = %d bytes free of %d, want a filesystem with blocks", root, disk.Free, disk.All)
+	}
+}
@@ -0,0 +1,74 @@
+package diskspace
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// GrowthRate is a rate of free space decline like `1G/10m`, i.e. 1GB less free space within 10 minutes
+type GrowthRate struct {
+	Bytes uint64
+	Per   time.Duration
+}
+
+// ParseGrowthRate parses a rate of the form size/duration, the size as by ParseByteSize and the duration as by time.ParseDuration
+func ParseGrowthRate(s string) (GrowthRate, error) {
+	size, per, ok := strings.Cut(s, "/")
+	if !ok {
+		return GrowthRate{}, fmt.Errorf("Invalid growth rate %q: must be size/duration, e.g. 1G/10m", s)
+	}
+	bytes, err := ParseByteSize(size)
+	if err != nil {
+		return GrowthRate{}, fmt.Errorf("Invalid growth rate %q: %v", s, err)
+	}
+	duration, err := time.ParseDuration(per)
+	if err != nil || duration <= 0 {
+		return GrowthRate{}, fmt.Errorf("Invalid growth rate %q: must be size/duration, e.g. 1G/10m", s)
+	}
+	return GrowthRate{Bytes: bytes, Per: duration}, nil
+}
+
+// BytesPerSecond returns the rate in bytes per second
+func (r GrowthRate) BytesPerSecond() float64 {
+	if r.Per <= 0 {
+		return 0
+	}
+	return float64(r.Bytes) / r.Per.Seconds()
+}
+
+// String returns the rate in the same form it is parsed from
+func (r GrowthRate) String() string {
+	return ByteSize(r.Bytes) + "/" + r.Per.String()
+}
+
+// Growth is the observed decline of free space of a disk across its recent samples
+type Growth struct {
+	// BytesPerSecond is how fast free space shrinks, negative when it grows
+	BytesPerSecond float64
+	// TimeToFull is the projected time until no free space is left at this rate, 0 unless declining noticeably
+	TimeToFull time.Duration
+	// FullAt is when the disk is projected to be full, zero along with TimeToFull
+	FullAt time.Time
+}
+
+// Declining reports whether free space is shrinking
+func (g Growth) Declining() bool {
+	return g.BytesPerSecond > 0
+}
+
+// Exhaustion returns FullAt in UTC, e.g. `2024-05-01 09:00 UTC`, or an empty string without a projection
+func (g Growth) Exhaustion() string {
+	if g.FullAt.IsZero() {
+		return ""
+	}
+	return g.FullAt.UTC().Format("2006-01-02 15:04 MST")
+}
+
+// Rate returns the decline of free space per hour, e.g. 1.5GB/h
+func (g Growth) Rate() string {
+	if !g.Declining() {
+		return "0/h"
+	}
+	return FormatBytes(uint64(g.BytesPerSecond*3600)) + "/h"
+}
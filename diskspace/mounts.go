@@ -0,0 +1,11 @@
+package diskspace
+
+// MountInfo is a single mounted filesystem as listed by ListMounts
+type MountInfo struct {
+	// Device is the mount source, e.g. /dev/sda1, or the filesystem type for pseudo filesystems like tmpfs
+	Device     string
+	MountPoint string
+	FSType     string
+	// Options are the mount options followed by the filesystem's own ones, e.g. rw, relatime and errors=remount-ro
+	Options []string
+}
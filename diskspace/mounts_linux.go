@@ -0,0 +1,161 @@
+package diskspace
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ListMounts lists the mounts of the current process in mount order, parsing /proc/self/mountinfo and falling back to
+// /proc/mounts on kernels without it
+func ListMounts() ([]MountInfo, error) {
+	file, err := os.Open("/proc/self/mountinfo")
+	if err == nil {
+		defer file.Close()
+		return parseMountInfo(file)
+	}
+	file, err = os.Open("/proc/mounts")
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return parseMounts(file)
+}
+
+// parseMountInfo parses the format of /proc/self/mountinfo, e.g.
+//
+//	36 35 98:0 / /mnt/data rw,noatime master:1 - ext4 /dev/sdb1 rw,errors=continue
+//
+// The optional fields before the - separator vary in number, the fields after it are located from there.
+func parseMountInfo(r io.Reader) ([]MountInfo, error) {
+	var mounts []MountInfo
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		separator := -1
+		for i := 6; i < len(fields); i++ {
+			if fields[i] == "-" {
+				separator = i
+				break
+			}
+		}
+		if separator < 0 || len(fields) < separator+3 {
+			continue
+		}
+		options := strings.Split(fields[5], ",")
+		if len(fields) > separator+3 {
+			for _, option := range strings.Split(fields[separator+3], ",") {
+				if !containsString(options, option) {
+					options = append(options, option)
+				}
+			}
+		}
+		mounts = append(mounts, MountInfo{
+			Device:     unescapeMountField(fields[separator+2]),
+			MountPoint: unescapeMountField(fields[4]),
+			FSType:     fields[separator+1],
+			Options:    options,
+		})
+	}
+	return mounts, scanner.Err()
+}
+
+// parseMounts parses the format of /proc/mounts, e.g. `/dev/sdb1 /mnt/data ext4 rw,noatime 0 0`
+func parseMounts(r io.Reader) ([]MountInfo, error) {
+	var mounts []MountInfo
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 {
+			continue
+		}
+		mounts = append(mounts, MountInfo{
+			Device:     unescapeMountField(fields[0]),
+			MountPoint: unescapeMountField(fields[1]),
+			FSType:     fields[2],
+			Options:    strings.Split(fields[3], ","),
+		})
+	}
+	return mounts, scanner.Err()
+}
+
+// containsString reports whether values contains value
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// unescapeMountField decodes the octal escapes (e.g. \040 for space) the kernel uses in /proc/mounts and mountinfo
+func unescapeMountField(field string) string {
+	if !strings.Contains(field, `\`) {
+		return field
+	}
+	var b strings.Builder
+	for i := 0; i < len(field); i++ {
+		if field[i] == '\\' && i+3 < len(field) {
+			if value, err := strconv.ParseUint(field[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(value))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(field[i])
+	}
+	return b.String()
+}
+
+// findMount returns the mount containing path, i.e. the one with the longest matching mount point.
+// When a mount point is mounted over, the last mount wins just like in the kernel.
+func findMount(path string) (MountInfo, bool) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return MountInfo{}, false
+	}
+	mounts, err := ListMounts()
+	if err != nil {
+		return MountInfo{}, false
+	}
+	found := false
+	best := MountInfo{}
+	for _, mount := range mounts {
+		if absPath != mount.MountPoint && mount.MountPoint != "/" && !strings.HasPrefix(absPath, mount.MountPoint+"/") {
+			continue
+		}
+		if !found || len(mount.MountPoint) >= len(best.MountPoint) {
+			best = mount
+			found = true
+		}
+	}
+	return best, found
+}
+
+// MountOf returns the mount point and filesystem type of the filesystem containing path,
+// or empty strings if they can't be determined
+func MountOf(path string) (string, string) {
+	mount, _ := findMount(path)
+	return mount.MountPoint, mount.FSType
+}
+
+// MountPoints returns every mount point of ListMounts once, in mount order
+func MountPoints() ([]string, error) {
+	mounts, err := ListMounts()
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	var points []string
+	for _, mount := range mounts {
+		if !seen[mount.MountPoint] {
+			seen[mount.MountPoint] = true
+			points = append(points, mount.MountPoint)
+		}
+	}
+	return points, nil
+}
@@ -0,0 +1,71 @@
+package diskspace
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseMountInfo(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want []MountInfo
+	}{
+		{
+			name: "no optional fields",
+			line: "22 1 8:1 / / rw,relatime - ext4 /dev/sda1 rw,errors=remount-ro",
+			want: []MountInfo{{Device: "/dev/sda1", MountPoint: "/", FSType: "ext4", Options: []string{"rw", "relatime", "errors=remount-ro"}}},
+		},
+		{
+			name: "optional fields",
+			line: "36 35 98:0 / /mnt/data rw,noatime shared:1 master:2 - ext4 /dev/sdb1 rw,errors=continue",
+			want: []MountInfo{{Device: "/dev/sdb1", MountPoint: "/mnt/data", FSType: "ext4", Options: []string{"rw", "noatime", "errors=continue"}}},
+		},
+		{
+			name: "escaped spaces",
+			line: `41 22 8:17 / /mnt/my\040data rw,relatime shared:20 - vfat /dev/disk\040one rw`,
+			want: []MountInfo{{Device: "/dev/disk one", MountPoint: "/mnt/my data", FSType: "vfat", Options: []string{"rw", "relatime"}}},
+		},
+		{
+			name: "pseudo filesystem",
+			line: "25 22 0:23 / /proc rw,nosuid,nodev,noexec,relatime shared:13 - proc proc rw",
+			want: []MountInfo{{Device: "proc", MountPoint: "/proc", FSType: "proc", Options: []string{"rw", "nosuid", "nodev", "noexec", "relatime"}}},
+		},
+		{
+			name: "missing separator",
+			line: "22 1 8:1 / / rw,relatime ext4 /dev/sda1 rw",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := parseMountInfo(strings.NewReader(test.line + "\n"))
+			if err != nil {
+				t.Fatalf("parseMountInfo() failed: %v", err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("parseMountInfo() = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseMounts(t *testing.T) {
+	input := `/dev/sda1 / ext4 rw,relatime,errors=remount-ro 0 0
+proc /proc proc rw,nosuid,nodev,noexec,relatime 0 0
+/dev/sdb1 /mnt/my\040data ext4 rw,noatime 0 0
+truncated line
+`
+	want := []MountInfo{
+		{Device: "/dev/sda1", MountPoint: "/", FSType: "ext4", Options: []string{"rw", "relatime", "errors=remount-ro"}},
+		{Device: "proc", MountPoint: "/proc", FSType: "proc", Options: []string{"rw", "nosuid", "nodev", "noexec", "relatime"}},
+		{Device: "/dev/sdb1", MountPoint: "/mnt/my data", FSType: "ext4", Options: []string{"rw", "noatime"}},
+	}
+	got, err := parseMounts(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parseMounts() failed: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseMounts() = %+v, want %+v", got, want)
+	}
+}
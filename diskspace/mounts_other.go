@@ -0,0 +1,21 @@
+//go:build !linux
+// +build !linux
+
+package diskspace
+
+import "errors"
+
+// ListMounts fails as listing mounts is only supported on Linux
+func ListMounts() ([]MountInfo, error) {
+	return nil, errors.New("Listing all mounts is only supported on Linux")
+}
+
+// MountOf returns empty strings as mount points and filesystem types are only resolved on Linux
+func MountOf(path string) (string, string) {
+	return "", ""
+}
+
+// MountPoints fails as listing mounts is only supported on Linux
+func MountPoints() ([]string, error) {
+	return nil, errors.New("Listing all mounts is only supported on Linux")
+}
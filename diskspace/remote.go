@@ -0,0 +1,90 @@
+package diskspace
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sshTimeout bounds a single remote df call including the SSH handshake
+const sshTimeout = 30 * time.Second
+
+// SplitRemoteDisk splits disk names of the form user@host:/path into the SSH destination and path.
+// The @ is required so Windows drive letters like C:\ aren't mistaken for hosts.
+func SplitRemoteDisk(name string) (destination string, path string, ok bool) {
+	i := strings.Index(name, ":")
+	if i < 0 || strings.Index(name[:i], "@") <= 0 || strings.Contains(name[:i], "/") {
+		return "", "", false
+	}
+	return name[:i], name[i+1:], true
+}
+
+// RemoteStatDisk calculates the disk usage of path on destination (user@host) by running `df` over SSH.
+// Authentication is left to ssh, i.e. the local SSH agent, and never prompts.
+// Inode counts aren't available this way and are left at zero.
+func RemoteStatDisk(destination string, path string) (DiskState, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), sshTimeout)
+	defer cancel()
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "ssh", "-o", "BatchMode=yes", "-o", "ConnectTimeout=10", destination, "df", "-P", "-k", "--", shellQuote(path))
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return DiskState{}, fmt.Errorf("Couldn't stat %s on %s: %v: %s", path, destination, err, strings.TrimSpace(stderr.String()))
+	}
+
+	localDisk, err := parseDf(stdout.String())
+	if err != nil {
+		return DiskState{}, fmt.Errorf("Couldn't stat %s on %s: %v", path, destination, err)
+	}
+	localDisk.Used = localDisk.All - localDisk.FreeTotal
+	setPercentages(&localDisk)
+	localDisk.InodesFreePercentage = 100
+	localDisk.Name = path
+	localDisk.Host = destination[strings.Index(destination, "@")+1:]
+	return localDisk, nil
+}
+
+// parseDf reads the sizes and mount point from the output of `df -P -k` for a single path
+func parseDf(output string) (DiskState, error) {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if len(lines) < 2 {
+		return DiskState{}, fmt.Errorf("unexpected df output %q", output)
+	}
+	// Filesystem 1024-blocks Used Available Capacity Mounted-on
+	fields := strings.Fields(lines[len(lines)-1])
+	if len(fields) < 6 {
+		return DiskState{}, fmt.Errorf("unexpected df output %q", output)
+	}
+	var blocks [3]uint64
+	for i := range blocks {
+		value, err := strconv.ParseUint(fields[i+1], 10, 64)
+		if err != nil {
+			return DiskState{}, fmt.Errorf("unexpected df output %q", output)
+		}
+		blocks[i] = value * KILOBYTE
+	}
+	localDisk := DiskState{}
+	localDisk.All = blocks[0]
+	localDisk.FreeTotal = blocks[0] - blocks[1]
+	localDisk.Free = blocks[2]
+	localDisk.MountPoint = strings.Join(fields[5:], " ")
+	return localDisk, nil
+}
+
+// shellQuote quotes s for the remote POSIX shell ssh runs the command in
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// StatDiskByName stats a local path, or a remote one for names of the form user@host:/path
+func StatDiskByName(name string) (DiskState, error) {
+	if destination, path, ok := SplitRemoteDisk(name); ok {
+		return RemoteStatDisk(destination, path)
+	}
+	return StatDisk(name)
+}
@@ -0,0 +1,64 @@
+package diskspace
+
+import (
+	"fmt"
+	"time"
+)
+
+// DiskUsageStatsAsString renders the disk usage statistics with ReportTemplate, DefaultTemplate unless replaced.
+// severity is danger, warning or good, the latter marks a disk within its threshold that is reported anyway,
+// and selects the label from Labels. run adds the footer of the check if set.
+func DiskUsageStatsAsString(disk DiskState, diskName string, threshold Threshold, host string, growth Growth, severity string, run *RunInfo) string {
+	disk.Name = diskName
+	disk.Host = host
+	return renderReport(TemplateData{DiskState: disk, Threshold: threshold, Growth: growth, OK: severity == "good", Severity: severity, Label: Labels[severity], Run: run})
+}
+
+// DiskRecoveryAsString concatenates the statistics of a disk that is back above its threshold into one string,
+// a single line led by the good label of Labels if MessageStyle is compact
+func DiskRecoveryAsString(disk DiskState, diskName string, threshold Threshold, host string, run *RunInfo) string {
+	if MessageStyle == "compact" {
+		name := host + ":" + diskName
+		if disk.DisplayName != "" {
+			name = disk.DisplayName + " (" + name + ")"
+		}
+		line := fmt.Sprintf("%s recovered, %d%% free (%s of %s) thr %s", name, disk.FreePercentage, FormatBytes(disk.Free), FormatBytes(disk.All), threshold)
+		if label := Labels["good"]; label != "" {
+			line = label + " " + line
+		}
+		if run != nil {
+			line += " (" + run.Footer() + ")"
+		}
+		return line
+	}
+	name := "`" + diskName + "`"
+	if disk.DisplayName != "" {
+		name = disk.DisplayName + " (" + name + ")"
+	}
+	statHeader := fmt.Sprintf("*RECOVERED*\nDISK SPACE BACK ABOVE THRESHOLD ON %s \nMACHINE `%s`\n", name, host)
+	statFree := fmt.Sprintf("FREE: %s\n", FormatBytes(disk.Free))
+	statFreePerc := fmt.Sprintf("Free space in percentage: %d%%\n", disk.FreePercentage)
+	statFooter := fmt.Sprintf("Using threshold %s", threshold)
+	if run != nil {
+		statFooter += "\n" + run.Footer()
+	}
+	return statHeader + statFree + statFreePerc + statFooter
+}
+
+// RunInfo is the metadata of a single check, shown in the footer of its reports
+type RunInfo struct {
+	Time    time.Time
+	Version string
+	// Checked is the number of disks checked, Alerting the number of them below their threshold or unexpectedly read-only
+	Checked  int
+	Alerting int
+}
+
+// Footer summarizes the run in one line, e.g. `Checked 5 disks, 2 alerting, at 2024-05-01 09:00 UTC by diskspace2slack 1.4.0`
+func (r RunInfo) Footer() string {
+	disks := "disks"
+	if r.Checked == 1 {
+		disks = "disk"
+	}
+	return fmt.Sprintf("Checked %d %s, %d alerting, at %s by diskspace2slack %s", r.Checked, disks, r.Alerting, r.Time.UTC().Format("2006-01-02 15:04 MST"), r.Version)
+}
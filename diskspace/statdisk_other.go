@@ -0,0 +1,14 @@
+//go:build !linux && !darwin && !freebsd && !openbsd && !dragonfly && !windows
+// +build !linux,!darwin,!freebsd,!openbsd,!dragonfly,!windows
+
+package diskspace
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// statDisk fails on platforms without a known statfs(2) layout, e.g. NetBSD and Solaris, which use statvfs(2)
+func statDisk(path string) (DiskState, error) {
+	return DiskState{}, fmt.Errorf("Disk stats aren't supported on %s", runtime.GOOS)
+}
@@ -0,0 +1,56 @@
+//go:build linux || darwin || freebsd || openbsd || dragonfly
+// +build linux darwin freebsd openbsd dragonfly
+
+package diskspace
+
+import "syscall"
+
+// statfs is syscall.Statfs, a variable so that it can be replaced where no real filesystem is at hand
+var statfs = syscall.Statfs
+
+// readOnlyFlag is ST_RDONLY of the statfs flags on Linux and MNT_RDONLY on macOS and the BSDs, which share its value
+const readOnlyFlag = 0x1
+
+// statfsCounts are the fields of syscall.Statfs_t that statDisk needs. Their names and types differ between
+// platforms, so each one converts its Statfs_t in statfsCountsOf.
+type statfsCounts struct {
+	bsize  uint64
+	blocks uint64
+	bavail uint64
+	bfree  uint64
+	files  uint64
+	ffree  uint64
+	flags  uint64
+}
+
+// statDisk reads the raw block and inode counts of path using statfs(2)
+func statDisk(path string) (DiskState, error) {
+	fs := syscall.Statfs_t{}
+	err := statfs(path, &fs)
+	if err != nil {
+		return DiskState{}, err
+	}
+	counts := statfsCountsOf(&fs)
+	localDisk := DiskState{}
+	localDisk.All = counts.blocks * counts.bsize
+	localDisk.Free = counts.bavail * counts.bsize
+	localDisk.FreeTotal = counts.bfree * counts.bsize
+	localDisk.InodesAll = counts.files
+	localDisk.InodesFree = counts.ffree
+	localDisk.ReadOnly = counts.flags&readOnlyFlag != 0
+	// The device ID identifies the filesystem, leave it unknown if it can't be read
+	st := syscall.Stat_t{}
+	if err := syscall.Stat(path, &st); err == nil {
+		localDisk.Device = uint64(st.Dev)
+	}
+	return localDisk, nil
+}
+
+// nonNegative converts a signed count to uint64. The BSDs report negative available blocks and inodes
+// once the space reserved for root is in use, which leaves nothing available to everyone else.
+func nonNegative(n int64) uint64 {
+	if n < 0 {
+		return 0
+	}
+	return uint64(n)
+}
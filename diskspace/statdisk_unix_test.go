@@ -0,0 +1,42 @@
+//go:build linux || darwin || freebsd || openbsd || dragonfly
+// +build linux darwin freebsd openbsd dragonfly
+
+package diskspace
+
+import (
+	"errors"
+	"syscall"
+	"testing"
+)
+
+// fakeStatfs replaces statfs with fake for the rest of the test
+func fakeStatfs(t *testing.T, fake func(path string, fs *syscall.Statfs_t) error) {
+	original := statfs
+	statfs = fake
+	t.Cleanup(func() { statfs = original })
+}
+
+func TestStatDiskStatfsError(t *testing.T) {
+	fakeStatfs(t, func(path string, fs *syscall.Statfs_t) error {
+		return errors.New("input/output error")
+	})
+	if _, err := StatDisk(t.TempDir()); err == nil {
+		t.Error("StatDisk() succeeded, want the statfs error")
+	}
+}
+
+// TestStatDiskZeroBlocks stats a pseudo-filesystem without blocks or inodes, which is all free rather than full
+func TestStatDiskZeroBlocks(t *testing.T) {
+	fakeStatfs(t, func(path string, fs *syscall.Statfs_t) error {
+		*fs = syscall.Statfs_t{}
+		return nil
+	})
+	disk, err := StatDisk(t.TempDir())
+	if err != nil {
+		t.Fatalf("StatDisk() failed: %v", err)
+	}
+	if disk.All != 0 || disk.FreePercentage != 100 || disk.UsedPercentage != 0 || disk.InodesFreePercentage != 100 {
+		t.Errorf("StatDisk() = %d bytes, %d%% free, %d%% used, %d%% inodes free, want 0, 100, 0 and 100",
+			disk.All, disk.FreePercentage, disk.UsedPercentage, disk.InodesFreePercentage)
+	}
+}
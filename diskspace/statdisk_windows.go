@@ -0,0 +1,22 @@
+package diskspace
+
+import "golang.org/x/sys/windows"
+
+// statDisk reads the capacity of the volume containing path, e.g. `C:\`, using GetDiskFreeSpaceExW.
+// Windows has no inode counts, so they are left at zero.
+func statDisk(path string) (DiskState, error) {
+	pathPtr, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return DiskState{}, err
+	}
+	var freeBytesAvailable, totalBytes, totalFreeBytes uint64
+	err = windows.GetDiskFreeSpaceEx(pathPtr, &freeBytesAvailable, &totalBytes, &totalFreeBytes)
+	if err != nil {
+		return DiskState{}, err
+	}
+	localDisk := DiskState{}
+	localDisk.All = totalBytes
+	localDisk.Free = freeBytesAvailable
+	localDisk.FreeTotal = totalFreeBytes
+	return localDisk, nil
+}
@@ -0,0 +1,16 @@
+package diskspace
+
+import "syscall"
+
+// statfsCountsOf converts fs, whose Bsize and Flags are uint32 on macOS
+func statfsCountsOf(fs *syscall.Statfs_t) statfsCounts {
+	return statfsCounts{
+		bsize:  uint64(fs.Bsize),
+		blocks: fs.Blocks,
+		bavail: fs.Bavail,
+		bfree:  fs.Bfree,
+		files:  fs.Files,
+		ffree:  fs.Ffree,
+		flags:  uint64(fs.Flags),
+	}
+}
@@ -0,0 +1,16 @@
+package diskspace
+
+import "syscall"
+
+// statfsCountsOf converts fs, all of whose counts are signed on DragonFly BSD
+func statfsCountsOf(fs *syscall.Statfs_t) statfsCounts {
+	return statfsCounts{
+		bsize:  nonNegative(fs.Bsize),
+		blocks: nonNegative(fs.Blocks),
+		bavail: nonNegative(fs.Bavail),
+		bfree:  nonNegative(fs.Bfree),
+		files:  nonNegative(fs.Files),
+		ffree:  nonNegative(fs.Ffree),
+		flags:  uint64(fs.Flags),
+	}
+}
@@ -0,0 +1,16 @@
+package diskspace
+
+import "syscall"
+
+// statfsCountsOf converts fs, whose Bavail and Ffree are signed on FreeBSD
+func statfsCountsOf(fs *syscall.Statfs_t) statfsCounts {
+	return statfsCounts{
+		bsize:  fs.Bsize,
+		blocks: fs.Blocks,
+		bavail: nonNegative(fs.Bavail),
+		bfree:  fs.Bfree,
+		files:  fs.Files,
+		ffree:  nonNegative(fs.Ffree),
+		flags:  fs.Flags,
+	}
+}
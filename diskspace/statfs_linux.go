@@ -0,0 +1,16 @@
+package diskspace
+
+import "syscall"
+
+// statfsCountsOf converts fs, whose Bsize and Flags are int64 on 64-bit Linux and int32 on 32-bit Linux
+func statfsCountsOf(fs *syscall.Statfs_t) statfsCounts {
+	return statfsCounts{
+		bsize:  uint64(fs.Bsize),
+		blocks: uint64(fs.Blocks),
+		bavail: uint64(fs.Bavail),
+		bfree:  uint64(fs.Bfree),
+		files:  uint64(fs.Files),
+		ffree:  uint64(fs.Ffree),
+		flags:  uint64(fs.Flags),
+	}
+}
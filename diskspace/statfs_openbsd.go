@@ -0,0 +1,16 @@
+package diskspace
+
+import "syscall"
+
+// statfsCountsOf converts fs, whose fields carry an F_ prefix on OpenBSD and whose F_bavail is signed
+func statfsCountsOf(fs *syscall.Statfs_t) statfsCounts {
+	return statfsCounts{
+		bsize:  uint64(fs.F_bsize),
+		blocks: fs.F_blocks,
+		bavail: nonNegative(fs.F_bavail),
+		bfree:  fs.F_bfree,
+		files:  fs.F_files,
+		ffree:  uint64(fs.F_ffree),
+		flags:  uint64(fs.F_flags),
+	}
+}
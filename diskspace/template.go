@@ -0,0 +1,108 @@
+package diskspace
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"text/template"
+)
+
+// DefaultTemplate is the message of a disk below its threshold unless ReportTemplate is replaced
+const DefaultTemplate = "{{with .Label}}{{.}}\n{{end}}" +
+	"{{if .ReadOnly}}MOUNTED READ-ONLY:{{else if .OK}}WITHIN THRESHOLD:{{else if .Directory}}LARGE DIRECTORY{{else}}LOW DISK SPACE ON{{end}} " +
+	"{{with .DisplayName}}{{.}} ({{end}}`{{.Name}}`{{if .DisplayName}}){{end}} \n" +
+	"MACHINE `{{.Host}}`\n" +
+	"{{if and .RealPath (ne .RealPath .Name)}}REAL PATH: `{{.RealPath}}`\n{{end}}" +
+	"{{if .MountPoint}}MOUNT POINT: `{{.MountPoint}}`\n{{end}}" +
+	"{{if .FSType}}FILESYSTEM: {{.FSType}}\n{{end}}" +
+	"{{if .Aliases}}ALSO CHECKED ON THIS FILESYSTEM: {{join .Aliases \" \"}}\n{{end}}" +
+	"{{if .Directory}}DIRECTORY SIZE: {{bytes .DirSize}}{{if .DirSkipped}} ({{.DirSkipped}} unreadable entries skipped){{end}}\n{{end}}" +
+	"TOTAL: {{bytes .All}}\n" +
+	"FREE: {{bytes .Free}}\n" +
+	"FREE INCL. RESERVED: {{bytes .FreeTotal}}\n" +
+	"USED: {{bytes .Used}}\n" +
+	"Free space in percentage: {{.FreePercentage}}%\n" +
+	"Used space in percentage: {{.UsedPercentage}}%\n" +
+	"INODES FREE: {{.InodesFree}} of {{.InodesAll}} ({{.InodesFreePercentage}}%)\n" +
+	"{{if .Growth.Declining}}FREE SPACE DROPPING: {{.Growth.Rate}}{{if .Growth.TimeToFull}}, FULL IN ~{{.Growth.TimeToFull}} ({{.Growth.Exhaustion}}){{end}}\n{{end}}" +
+	"Using threshold {{.Threshold}}" +
+	"{{with .Run}}\n{{.Footer}}{{end}}"
+
+// CompactTemplate renders a report as a single line, e.g. `:warning: web1:/var 3% free (2.1GB of 100GB) thr 10%`
+const CompactTemplate = "{{with .Label}}{{.}} {{end}}{{with .DisplayName}}{{.}} ({{end}}{{.Host}}:{{.Name}}{{if .DisplayName}}){{end}} " +
+	"{{if .Directory}}size {{bytes .DirSize}}{{else}}{{.FreePercentage}}% free ({{bytes .Free}} of {{bytes .All}}){{end}}" +
+	"{{if .ReadOnly}} read-only{{end}}" +
+	"{{if .Growth.Declining}} dropping {{.Growth.Rate}}{{with .Growth.TimeToFull}}, full in ~{{.}}{{end}}{{end}}" +
+	" thr {{.Threshold}}" +
+	"{{with .Run}} ({{.Footer}}){{end}}"
+
+// defaultReportTemplate is DefaultTemplate parsed
+var defaultReportTemplate = template.Must(ParseTemplate(DefaultTemplate))
+
+// compactReportTemplate is CompactTemplate parsed
+var compactReportTemplate = template.Must(ParseTemplate(CompactTemplate))
+
+// MessageStyle is verbose for the multi-line DefaultTemplate or compact for CompactTemplate and single line recoveries.
+// A ReportTemplate other than the default is used regardless.
+var MessageStyle = "verbose"
+
+// ReportTemplate renders DiskUsageStatsAsString, replace it with a template from ParseTemplate to customize reports
+var ReportTemplate = defaultReportTemplate
+
+// Labels start the reports of DefaultTemplate by severity: danger below the critical level, warning below the
+// threshold and good for disks within it. Replace them to match a team's conventions, e.g. with emoji.
+var Labels = map[string]string{
+	"danger":  "*WARNING!*",
+	"warning": "*WARNING!*",
+	"good":    "*OK*",
+}
+
+// TemplateData is passed to the report template, giving access to all DiskState fields, the threshold,
+// the observed growth, whether the disk is OK, its severity along with its label and the metadata of the run if known
+type TemplateData struct {
+	DiskState
+	Threshold Threshold
+	Growth    Growth
+	OK        bool
+	Severity  string
+	Label     string
+	Run       *RunInfo
+}
+
+// TemplateFuncs are the functions available in report templates in addition to the text/template builtins
+var TemplateFuncs = template.FuncMap{
+	// bytes formats a byte count with FormatBytes, e.g. {{bytes .Free}}
+	"bytes": func(bytes uint64) string { return FormatBytes(bytes) },
+	// join concatenates strings with a separator, e.g. {{join .Aliases ", "}}
+	"join": strings.Join,
+}
+
+// ParseTemplate parses text as a report template.
+// It renders the template once against an empty disk so that references to unknown fields are caught here
+// instead of when the first report is sent.
+func ParseTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("report").Funcs(TemplateFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid template: %v", err)
+	}
+	if err := tmpl.Execute(io.Discard, TemplateData{}); err != nil {
+		return nil, fmt.Errorf("Invalid template: %v", err)
+	}
+	return tmpl, nil
+}
+
+// renderReport renders ReportTemplate for data, falling back to DefaultTemplate if it fails
+func renderReport(data TemplateData) string {
+	tmpl := ReportTemplate
+	if MessageStyle == "compact" && tmpl == defaultReportTemplate {
+		tmpl = compactReportTemplate
+	}
+	var message strings.Builder
+	if err := tmpl.Execute(&message, data); err != nil {
+		slog.Error("Couldn't render report template, using the default", "path", data.Name, "error", err)
+		message.Reset()
+		defaultReportTemplate.Execute(&message, data)
+	}
+	return message.String()
+}
@@ -0,0 +1,183 @@
+package diskspace
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Threshold is the amount of free space below which a disk alerts.
+// It is either a percentage of the disk (e.g. `10` or `10%`) or an absolute size (e.g. `5G`).
+// An optional critical level of the same kind escalates alerts, e.g. `20:10` warns below 20% and is critical below 10%.
+// Percentages can also be given as used space, e.g. `used:80` alerts below 20% free.
+type Threshold struct {
+	Value    uint64
+	Absolute bool
+	// Critical is the critical level when HasCritical is set, otherwise the default of CriticalBreached applies
+	Critical    uint64
+	HasCritical bool
+	// Used marks a threshold given as used percentage, Value and Critical are free percentages all the same
+	Used bool
+	// Inclusive also alerts for disks exactly at a level
+	Inclusive bool
+}
+
+// usedPrefix starts a threshold given as used percentage
+const usedPrefix = "used:"
+
+// ParseThreshold parses a threshold of the form [used:]warning[:critical]. A bare number or a trailing `%` denotes
+// percentage, anything else is parsed as an absolute size by ParseByteSize. Both levels have to be of the same kind
+// and the critical level below the warning level, or above it for used percentages.
+func ParseThreshold(s string) (Threshold, error) {
+	threshold := Threshold{Used: strings.HasPrefix(s, usedPrefix)}
+	// level parses a single level, converting used percentages to free ones
+	level := func(s string) (uint64, bool, error) {
+		value, absolute, err := parseThresholdLevel(s)
+		if err != nil || !threshold.Used {
+			return value, absolute, err
+		}
+		if absolute {
+			return 0, false, errors.New("used thresholds must be percentages")
+		}
+		return 100 - value, false, nil
+	}
+	warning, critical, hasCritical := strings.Cut(strings.TrimPrefix(s, usedPrefix), ":")
+	value, absolute, err := level(warning)
+	if err != nil {
+		return Threshold{}, fmt.Errorf("Invalid threshold %q: %v", s, err)
+	}
+	threshold.Value = value
+	threshold.Absolute = absolute
+	if !hasCritical {
+		return threshold, nil
+	}
+	criticalValue, criticalAbsolute, err := level(critical)
+	if err != nil {
+		return Threshold{}, fmt.Errorf("Invalid threshold %q: %v", s, err)
+	}
+	if criticalAbsolute != absolute {
+		return Threshold{}, fmt.Errorf("Invalid threshold %q: warning and critical level must both be percentages or sizes", s)
+	}
+	if criticalValue >= value && threshold.Used {
+		return Threshold{}, fmt.Errorf("Invalid threshold %q: critical level must be above the warning level", s)
+	}
+	if criticalValue >= value {
+		return Threshold{}, fmt.Errorf("Invalid threshold %q: critical level must be below the warning level", s)
+	}
+	threshold.Critical = criticalValue
+	threshold.HasCritical = true
+	return threshold, nil
+}
+
+// parseThresholdLevel parses a single level of a threshold, reporting whether it is an absolute size
+func parseThresholdLevel(s string) (uint64, bool, error) {
+	if strings.HasSuffix(s, "%") || isDigits(s) {
+		value, err := strconv.ParseUint(strings.TrimSuffix(s, "%"), 10, 64)
+		if err != nil {
+			return 0, false, errors.New("must be a percentage (10 or 10%) or a size (5G)")
+		}
+		if value > 100 {
+			return 0, false, errors.New("percentage above 100")
+		}
+		return value, false, nil
+	}
+	value, err := ParseByteSize(s)
+	if err != nil {
+		return 0, false, errors.New("must be a percentage (10 or 10%) or a size (5G)")
+	}
+	return value, true, nil
+}
+
+// Breached reports whether disk has less free space (or, for percentages, free inodes) than the threshold,
+// or for a measured directory whether it is larger than the threshold
+func (t Threshold) Breached(disk DiskState) bool {
+	if disk.Directory {
+		return disk.DirSize > t.Value || (t.Inclusive && disk.DirSize == t.Value)
+	}
+	return t.below(disk, t.Value)
+}
+
+// CriticalBreached reports whether disk is below the critical level of the threshold,
+// or below defaultCritical percent if it has none. Measured directories are never critical.
+func (t Threshold) CriticalBreached(disk DiskState, defaultCritical uint64) bool {
+	if disk.Directory {
+		return false
+	}
+	if !t.HasCritical {
+		return Threshold{Inclusive: t.Inclusive}.below(disk, defaultCritical)
+	}
+	return t.below(disk, t.Critical)
+}
+
+// below reports whether disk has less free space than level, a size or percentage like the threshold,
+// or exactly level if the threshold is Inclusive
+func (t Threshold) below(disk DiskState, level uint64) bool {
+	less := func(value uint64) bool {
+		return value < level || (t.Inclusive && value == level)
+	}
+	if t.Absolute {
+		return less(disk.Free)
+	}
+	return less(disk.FreePercentage) || less(disk.InodesFreePercentage)
+}
+
+// String returns the threshold in the same form it is parsed from
+func (t Threshold) String() string {
+	s := t.formatLevel(t.Value)
+	if t.HasCritical {
+		s += ":" + t.formatLevel(t.Critical)
+	}
+	if t.Used {
+		s = usedPrefix + s
+	}
+	return s
+}
+
+// formatLevel formats a single level of the threshold, as used percentage for Used thresholds
+func (t Threshold) formatLevel(level uint64) string {
+	if t.Absolute {
+		return ByteSize(level)
+	}
+	if t.Used {
+		return fmt.Sprintf("%d%%", 100-level)
+	}
+	return fmt.Sprintf("%d%%", level)
+}
+
+// MarshalJSON encodes the threshold as a string in the ParseThreshold format
+func (t Threshold) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.String())
+}
+
+// UnmarshalJSON accepts both numbers (percentages) and strings in the ParseThreshold format
+func (t *Threshold) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		var value uint64
+		if err := json.Unmarshal(data, &value); err != nil {
+			return errors.New("threshold must be a number or a string")
+		}
+		s = strconv.FormatUint(value, 10)
+	}
+	threshold, err := ParseThreshold(s)
+	if err != nil {
+		return err
+	}
+	*t = threshold
+	return nil
+}
+
+// isDigits reports whether s is a non-empty string of ASCII digits
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,87 @@
+package diskspace
+
+import "testing"
+
+func TestParseThreshold(t *testing.T) {
+	tests := []struct {
+		input string
+		want  Threshold
+	}{
+		{"10", Threshold{Value: 10}},
+		{"10%", Threshold{Value: 10}},
+		{"5G", Threshold{Value: 5 * GIGABYTE, Absolute: true}},
+		{"500m", Threshold{Value: 500 * MEGABYTE, Absolute: true}},
+		{"20:10", Threshold{Value: 20, Critical: 10, HasCritical: true}},
+		{"10G:5G", Threshold{Value: 10 * GIGABYTE, Absolute: true, Critical: 5 * GIGABYTE, HasCritical: true}},
+		{"used:80", Threshold{Value: 20, Used: true}},
+		{"used:80:90", Threshold{Value: 20, Critical: 10, HasCritical: true, Used: true}},
+	}
+	for _, test := range tests {
+		got, err := ParseThreshold(test.input)
+		if err != nil {
+			t.Errorf("ParseThreshold(%q) failed: %v", test.input, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("ParseThreshold(%q) = %+v, want %+v", test.input, got, test.want)
+		}
+		// String returns a form that parses back to the same threshold
+		if again, err := ParseThreshold(got.String()); err != nil || again != got {
+			t.Errorf("ParseThreshold(%q) = %+v, want %+v", got.String(), again, got)
+		}
+	}
+}
+
+func TestParseThresholdInvalid(t *testing.T) {
+	for _, input := range []string{"", "abc", "101", "-5", "10:20", "10:10", "10:5G", "used:5G", "used:80:70"} {
+		if threshold, err := ParseThreshold(input); err == nil {
+			t.Errorf("ParseThreshold(%q) = %+v, want an error", input, threshold)
+		}
+	}
+}
+
+func TestThresholdBreached(t *testing.T) {
+	// disk has 10% and 10GB of 100GB free
+	disk := DiskState{All: 100 * GIGABYTE, Free: 10 * GIGABYTE, FreePercentage: 10, InodesFreePercentage: 100}
+	tests := []struct {
+		name      string
+		threshold Threshold
+		breached  bool
+		critical  bool
+	}{
+		{"percentage above", Threshold{Value: 20}, true, false},
+		{"percentage below", Threshold{Value: 5}, false, false},
+		{"percentage at boundary", Threshold{Value: 10}, false, false},
+		{"percentage at boundary inclusive", Threshold{Value: 10, Inclusive: true}, true, false},
+		{"absolute above", Threshold{Value: 20 * GIGABYTE, Absolute: true}, true, false},
+		{"absolute below", Threshold{Value: 5 * GIGABYTE, Absolute: true}, false, false},
+		{"absolute at boundary", Threshold{Value: 10 * GIGABYTE, Absolute: true}, false, false},
+		{"critical level", Threshold{Value: 30, Critical: 20, HasCritical: true}, true, true},
+		{"above critical level", Threshold{Value: 30, Critical: 5, HasCritical: true}, true, false},
+		{"critical at boundary", Threshold{Value: 30, Critical: 10, HasCritical: true}, true, false},
+		{"absolute critical level", Threshold{Value: 30 * GIGABYTE, Absolute: true, Critical: 15 * GIGABYTE, HasCritical: true}, true, true},
+		{"default critical", Threshold{Value: 30}, true, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if breached := test.threshold.Breached(disk); breached != test.breached {
+				t.Errorf("Breached() = %v, want %v", breached, test.breached)
+			}
+			if critical := test.threshold.CriticalBreached(disk, 5); critical != test.critical {
+				t.Errorf("CriticalBreached() = %v, want %v", critical, test.critical)
+			}
+		})
+	}
+}
+
+func TestThresholdDefaultCritical(t *testing.T) {
+	disk := DiskState{FreePercentage: 3, InodesFreePercentage: 100}
+	if !(Threshold{Value: 10}).CriticalBreached(disk, 5) {
+		t.Error("3% free isn't critical below the default of 5%")
+	}
+	// Inodes count towards percentage thresholds
+	disk = DiskState{FreePercentage: 50, InodesFreePercentage: 3}
+	if !(Threshold{Value: 10}).Breached(disk) {
+		t.Error("3% free inodes don't breach a 10% threshold")
+	}
+}
@@ -1,163 +1,773 @@
 package main
 
 import (
-	"errors"
+	"context"
 	"flag"
 	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
 	"os"
-	"strconv"
+	"os/signal"
 	"strings"
 	"sync"
 	"syscall"
+	"time"
 
-	"github.com/nlopes/slack"
+	"github.com/danthelion/diskspace2slack/diskspace"
+	"go.opentelemetry.io/otel/attribute"
 )
 
-const (
-	BYTE     = 1.0
-	KILOBYTE = 1024 * BYTE
-	MEGABYTE = 1024 * KILOBYTE
-	GIGABYTE = 1024 * MEGABYTE
-	TERABYTE = 1024 * GIGABYTE
+// Build information, stamped by CI via -ldflags "-X main.version=... -X main.commit=... -X main.date=..."
+var (
+	version = "dev"
+	commit  = "unknown"
+	date    = "unknown"
 )
 
-// ByteSize returns a human-readable byte string of the form 10M, 12.5K, and so forth.
-// The unit that results in the smallest number greater than or equal to 1 is always chosen.
-func ByteSize(bytes uint64) string {
-	unit := ""
-	value := float32(bytes)
-	switch {
-	case bytes >= TERABYTE:
-		unit = "TB"
-		value = value / TERABYTE
-	case bytes >= GIGABYTE:
-		unit = "GB"
-		value = value / GIGABYTE
-	case bytes >= MEGABYTE:
-		unit = "MB"
-		value = value / MEGABYTE
-	case bytes >= KILOBYTE:
-		unit = "KB"
-		value = value / KILOBYTE
-	case bytes >= BYTE:
-		unit = "B"
-	case bytes == 0:
-		return "0"
-	}
-
-	stringValue := fmt.Sprintf("%.1f", value)
-	stringValue = strings.TrimSuffix(stringValue, ".0")
-	return fmt.Sprintf("%s%s", stringValue, unit)
-}
+// hostnameTimeout bounds the lookup of the machine hostname, which can hang on misconfigured systems
+const hostnameTimeout = 2 * time.Second
+
+// machineHostname caches the hostname of the machine, it is looked up once per process
+var (
+	machineHostnameOnce sync.Once
+	machineHostname     string
+)
 
-// DiskState represents available/used/free space on drive
-type DiskState struct {
-	Host           string
-	Name           string
-	All            uint64
-	Used           uint64
-	Free           uint64
-	FreePercentage uint64
+// ResolveHostname returns override if set, otherwise the hostname of the machine or `Unknown` if it can't be determined in time
+func ResolveHostname(override string) string {
+	if override != "" {
+		return override
+	}
+	machineHostnameOnce.Do(func() {
+		result := make(chan string, 1)
+		go func() {
+			host, err := os.Hostname()
+			if err != nil {
+				slog.Warn("Unable to get hostname, using `Unknown`", "error", err)
+				host = "Unknown"
+			}
+			result <- host
+		}()
+		select {
+		case machineHostname = <-result:
+		case <-time.After(hostnameTimeout):
+			slog.Warn("Getting the hostname timed out, using `Unknown`", "timeout", hostnameTimeout.String())
+			machineHostname = "Unknown"
+		}
+	})
+	return machineHostname
 }
 
-// StatDisk calculates the disk usage of path/disk
-func StatDisk(path string) (DiskState, error) {
-	fs := syscall.Statfs_t{}
-	err := syscall.Statfs(path, &fs)
+// SendDiskSpaceReport hands alert to notifier
+func SendDiskSpaceReport(ctx context.Context, notifier Notifier, alert Alert) error {
+	ctx, span := startSpan(ctx, "notify", append(diskAttrs(alert.Disk), attribute.String("target", alert.Target))...)
+	err := notifier.Notify(ctx, alert)
+	endSpan(span, err)
 	if err != nil {
-		return DiskState{}, errors.New("Couldn't stat path " + path)
-	}
-	localDisk := DiskState{}
-	localDisk.All = fs.Blocks * uint64(fs.Bsize)
-	localDisk.Free = fs.Bavail * uint64(fs.Bsize)
-	localDisk.FreePercentage = uint64(float32(localDisk.Free) / float32(localDisk.All) * 100)
-	localDisk.Used = localDisk.All - localDisk.Free
-	host, err := os.Hostname()
+		return fmt.Errorf("Couldn't send report for %s to %s: %v", alert.Disk.Name, alert.Target, err)
+	}
+	return nil
+}
+
+// SendBatchReport hands all alerts for target to notifier at once
+func SendBatchReport(ctx context.Context, notifier BatchNotifier, target string, alerts []Alert) error {
+	ctx, span := startSpan(ctx, "notify_batch", attribute.String("target", target), attribute.Int("disks", len(alerts)))
+	err := notifier.NotifyBatch(ctx, target, alerts)
+	endSpan(span, err)
 	if err != nil {
-		fmt.Print("Unable to get hostname. Using `Unknown`.")
-		host = "Unknown"
+		return fmt.Errorf("Couldn't send batch report for %d disks to %s: %v", len(alerts), target, err)
 	}
+	return nil
+}
 
-	localDisk.Name = path
-	localDisk.Host = host
-	return localDisk, nil
+// SendSummaryReport hands summary for target to notifier
+func SendSummaryReport(ctx context.Context, notifier SummaryNotifier, target string, summary RunSummary) error {
+	ctx, span := startSpan(ctx, "notify_summary", attribute.String("target", target), attribute.Int("disks", summary.Checked), attribute.Int("breached", len(summary.Breached)))
+	err := notifier.NotifySummary(ctx, target, summary)
+	endSpan(span, err)
+	if err != nil {
+		return fmt.Errorf("Couldn't send summary to %s: %v", target, err)
+	}
+	return nil
 }
 
-// DiskUsageStatsAsString concatenates disk usage statistics into one string
-func DiskUsageStatsAsString(disk DiskState, diskName string, threshold uint64, host string) string {
-	statHeader := fmt.Sprintf("*WARNING!*\nLOW DISK SPACE ON `%s` \nMACHINE `%s`\n", diskName, host)
-	statAll := fmt.Sprintf("TOTAL: %s\n", ByteSize(disk.All))
-	statFree := fmt.Sprintf("FREE: %s\n", ByteSize(disk.Free))
-	statUsed := fmt.Sprintf("USED: %s\n", ByteSize(disk.Used))
-	statFreePerc := fmt.Sprintf("Free space in percentage: %d%%\n", disk.FreePercentage)
-	statFooter := fmt.Sprintf("Using threshold %d%%", threshold)
-	return statHeader + statAll + statFree + statUsed + statFreePerc + statFooter
+// PrintReportErrors logs a summary of failed reports and reports whether there were any
+func PrintReportErrors(reportCount int, reportErrors []error) bool {
+	if len(reportErrors) == 0 {
+		return false
+	}
+	slog.Error("Some reports failed", "failed", len(reportErrors), "total", reportCount)
+	for _, err := range reportErrors {
+		slog.Error("Report failed", "error", err)
+	}
+	return true
 }
 
-// SendDiskSpaceReport compares current free disk space to threshold
-func SendDiskSpaceReport(disk DiskState, threshold uint64, target string, wg *sync.WaitGroup) {
-	api := slack.New(os.Getenv("SLACK_SECRET_KEY"))
-	// Decrement WaitGroup counter
-	defer wg.Done()
-	params := slack.PostMessageParameters{}
-	channelID, timestamp, err := api.PostMessage(target, DiskUsageStatsAsString(disk, disk.Name, threshold, disk.Host), params)
-	if err != nil {
-		panic(err)
+// PostCheckErrors posts the stat and report errors of result to channel using reporter, if it is set.
+// Failing to post is only logged, never reported again, so that a broken error channel can't loop.
+func PostCheckErrors(ctx context.Context, reporter *SlackNotifier, channel string, host string, result CheckResult) {
+	errs := append(append([]error{}, result.StatErrors...), result.Errors...)
+	if reporter == nil || len(errs) == 0 {
+		return
+	}
+	if err := reporter.NotifyErrors(context.WithoutCancel(ctx), channel, host, errs); err != nil {
+		slog.Error("Couldn't post errors to the error channel", "channel", channel, "errors", len(errs), "error", err)
 	}
-	fmt.Printf("%s - Message sent to %s\n", timestamp, channelID)
 }
 
-// MapStrToInt will map a atoi function to a slice
-func MapStrToInt(strArray []string) []uint64 {
-	intArray := make([]uint64, len(strArray))
+// MapStrToThreshold will map ParseThreshold to a slice, stopping at the first invalid value
+func MapStrToThreshold(strArray []string) ([]diskspace.Threshold, error) {
+	thresholdArray := make([]diskspace.Threshold, len(strArray))
 	for i, v := range strArray {
-		intValue, err := strconv.ParseUint(v, 10, 64)
+		threshold, err := diskspace.ParseThreshold(v)
 		if err != nil {
-			panic(err)
+			return nil, err
 		}
-		intArray[i] = intValue
+		thresholdArray[i] = threshold
 	}
-	return intArray
+	return thresholdArray, nil
 }
 
 func main() {
 	// Parse cmd args
-	diskNamePtr := flag.String("disk", "/ /tmp", "Disk names as Strings, separated by space.")
-	thresholdPtr := flag.String("threshold", "10 10", "Integers representing the maximum percentage of free space before alerting, seperated by spaces.")
+	flag.String("disk", "/ /tmp", "Disk names as Strings, separated by space. Globs like /mnt/data* and all (every mount) are expanded. Falls back to DISKSPACE_DISKS.")
+	flag.String("threshold", "10 10", "Minimum free space before alerting, seperated by spaces, or a single one for all disks. Either a free percentage (10 or 10%), a used percentage (used:90) or an absolute size (5G), optionally followed by a critical level, e.g. 20:10. Falls back to DISKSPACE_THRESHOLDS.")
 	targetPtr := flag.String("target", "#target_slack_channel", "Target Person or Channel on Slack.")
+	targetMapPtr := flag.String("target-map", "", "Per-disk targets overriding -target, as path=target pairs separated by space, e.g. \"/var/lib/mysql=#dba /srv=#web\". The target key of the config file takes precedence.")
+	slackTimeoutPtr := flag.Duration("slack-timeout", 10*time.Second, "Maximum time to wait for Slack to accept a report, 0 waits forever.")
+	slackRetriesPtr := flag.Int("slack-retries", 3, "Maximum attempts to post a report when Slack is rate limiting or unavailable.")
+	webhookPtr := flag.String("webhook", "", "Slack Incoming Webhook URL. Takes precedence over SLACK_SECRET_KEY; falls back to SLACK_WEBHOOK_URL.")
+	envFilePtr := flag.String("env-file", "", "Dotenv file of KEY=VALUE lines to load into the environment, e.g. SLACK_SECRET_KEY. Variables that are already set take precedence.")
+	slackTokenFilePtr := flag.String("slack-token-file", "", "File containing the Slack API token, e.g. a mounted Docker or Kubernetes secret. Takes precedence over SLACK_SECRET_KEY.")
+	slackUsernamePtr := flag.String("slack-username", "", "Bot username of Slack reports, e.g. DiskWatcher. Webhooks post with their own identity.")
+	slackIconEmojiPtr := flag.String("slack-icon-emoji", "", "Bot icon of Slack reports as an emoji, e.g. :floppy_disk:.")
+	slackIconURLPtr := flag.String("slack-icon-url", "", "Bot icon of Slack reports as an image URL.")
+	proxyPtr := flag.String("proxy", "", "Proxy URL for Slack requests, e.g. http://proxy.example.com:3128. HTTPS_PROXY and HTTP_PROXY are honored without it.")
+	dryRunPtr := flag.Bool("dry-run", false, "Print reports to stdout instead of sending them, same as -notifier stdout.")
+	notifierPtr := flag.String("notifier", "slack", "Backends that receive the reports, separated by comma: slack, email, pagerduty, teams, discord, http or stdout.")
+	cooldownPtr := flag.Duration("cooldown", 0, "Suppress further alerts for a disk on every notifier for this duration (e.g. 1h) after it alerted. The cooldown_exempt config key lists notifiers that get every alert.")
+	smtpHostPtr := flag.String("smtp-host", "", "SMTP server for -notifier email. Falls back to SMTP_HOST.")
+	smtpPortPtr := flag.String("smtp-port", "", "SMTP server port. Falls back to SMTP_PORT, then 587.")
+	smtpUsernamePtr := flag.String("smtp-username", "", "SMTP username. Falls back to SMTP_USERNAME.")
+	smtpPasswordPtr := flag.String("smtp-password", "", "SMTP password. Falls back to SMTP_PASSWORD.")
+	smtpStartTLSPtr := flag.Bool("smtp-starttls", true, "Upgrade the SMTP connection with STARTTLS before authenticating.")
+	emailFromPtr := flag.String("email-from", "", "Sender address of alert emails. Falls back to EMAIL_FROM.")
+	emailToPtr := flag.String("email-to", "", "Recipients of alert emails, separated by comma. Falls back to EMAIL_TO.")
+	pagerDutyKeyPtr := flag.String("pagerduty-key", "", "PagerDuty Events API v2 routing key for -notifier pagerduty. Falls back to PAGERDUTY_ROUTING_KEY.")
+	teamsWebhookPtr := flag.String("teams-webhook", "", "Microsoft Teams Incoming Webhook URL for -notifier teams. Falls back to TEAMS_WEBHOOK_URL.")
+	discordWebhookPtr := flag.String("discord-webhook", "", "Discord webhook URL for -notifier discord. Falls back to DISCORD_WEBHOOK_URL.")
+	httpURLPtr := flag.String("http-url", "", "URL that -notifier http posts JSON reports to.")
+	httpTemplatePtr := flag.String("http-template", "", "Go text/template of the -notifier http request body, with the fields of -template, .Recovered and json, e.g. '{\"path\": {{json .Name}}}'.")
+	var repeatedDisks diskFlag
+	flag.Var(&repeatedDisks, "d", "Disk and its threshold as path=threshold, e.g. -d /=20 -d /var=10:5, can be repeated. Takes precedence over -disk and -threshold, which are only used along with it when -disk is set.")
+	var labels labelFlag
+	flag.Var(&labels, "label", "Friendly name of a disk shown along with its path in reports, as path=label, e.g. -label \"/srv/app/data=App Data\", can be repeated. The label key of the config file takes precedence.")
+	var httpHeaders listFlag
+	flag.Var(&httpHeaders, "http-header", "Header added to -notifier http requests as \"Key: Value\", can be repeated.")
+	configPtr := flag.String("config", "", "Path to a JSON config file with per-disk thresholds and targets. Overrides -disk and -threshold.")
+	inclusivePtr := flag.Bool("inclusive", false, "Also alert for disks exactly at their threshold, e.g. at 10% free for a threshold of 10.")
+	criticalPtr := flag.Uint64("critical", 5, "Percentage of free space below which alerts are colored as critical (red) instead of warning (yellow) and PagerDuty incidents are triggered, unless the threshold has its own critical level.")
+	mentionPtr := flag.String("mention", "", "Slack mention posted with critical alerts, e.g. \"<!here>\" or \"<@U12345>\".")
+	messageStylePtr := flag.String("message-style", "verbose", "Layout of the default report: verbose for several lines per disk, or compact for a single line like \":warning: web1:/var 3% free (2.1GB of 100GB) thr 10%\".")
+	warnLabelPtr := flag.String("warn-label", diskspace.Labels["warning"], "First line of reports for disks below their threshold, e.g. \"🟡 *Low disk*\". Empty leaves it out.")
+	critLabelPtr := flag.String("crit-label", diskspace.Labels["danger"], "First line of reports for disks below the critical level and unexpectedly read-only ones, e.g. \"🔴 *Disk critical*\". Empty leaves it out.")
+	okLabelPtr := flag.String("ok-label", diskspace.Labels["good"], "First line of -report-always reports for disks within their threshold, e.g. \"🟢 *OK*\". Empty leaves it out.")
+	errorChannelPtr := flag.String("error-channel", "", "Slack channel that the tool's own failures are posted to, e.g. #ops: disks that couldn't be stat'ed and reports that failed after all retries. Needs SLACK_SECRET_KEY or -slack-token-file and the slack notifier.")
+	threadPtr := flag.Bool("thread", false, "Post Slack reports as replies to a daily \"Disk report\" message per target. Needs SLACK_SECRET_KEY, webhooks can't reply in threads.")
+	groupByHostPtr := flag.Bool("group-by-host", false, "Send one message per host listing all its reports, like -batch but per host and target.")
+	batchPtr := flag.Bool("batch", false, "Send all reports for the same target as one message instead of one message per disk.")
+	maxConcurrencyPtr := flag.Int("max-concurrency", 3, "Maximum number of reports sent at once, 0 for no limit.")
+	intervalPtr := flag.Duration("interval", 0, "Poll the disks every interval (e.g. 5m) until interrupted. Runs once when 0.")
+	growthAlertPtr := flag.String("growth-alert", "", "With -interval, also alert when free space drops faster than this rate, e.g. 1G/10m.")
+	predictWindowPtr := flag.Duration("predict-window", 0, "With -interval, also alert when a disk is projected to be full within this time, e.g. 24h, by a linear fit of its free space across -growth-samples checks.")
+	growthSamplesPtr := flag.Int("growth-samples", 5, "Number of recent checks the -growth-alert rate and -predict-window projection are measured across.")
+	maxRuntimePtr := flag.Duration("max-runtime", 0, "Exit with code 3 if a single run doesn't finish within this duration (e.g. 5m), logging the stats and reports still pending. 0 means no limit.")
+	shutdownTimeoutPtr := flag.Duration("shutdown-timeout", 30*time.Second, "Maximum time to wait for pending reports after SIGINT/SIGTERM, a second signal exits right away.")
+	stateFilePtr := flag.String("state-file", "", "JSON file keeping the alert state between runs, so -remind-after and recovery reports work without -interval.")
+	remindAfterPtr := flag.Duration("remind-after", 0, "With -interval or -state-file, alert again for a disk that stays below its threshold only after this duration (e.g. 6h). Alerts on every poll when 0.")
+	percentageBasisPtr := flag.String("percentage-basis", "total", "Size free and used percentages are relative to: total (all blocks) or df (used plus available blocks, leaving out the ones reserved for root, like df).")
+	unitsPtr := flag.String("units", "iec", "Units of byte values in reports: iec (powers of 1024) or si (powers of 1000).")
+	byteFormatPtr := flag.String("byte-format", "short", "Labels of byte values in reports: short (10.5MB) or long (10.5 MB).")
+	thousandsSeparatorPtr := flag.String("thousands-separator", diskspace.ThousandsSeparator, "Groups the thousands of byte values with -byte-format long, e.g. 1,020 MB. Use \".\" (which makes the decimal mark \",\") or \" \" for other locales, or \"\" for none.")
+	modePtr := flag.String("mode", "fs", "What to check at every -disk path: fs for the free space of its filesystem, dir for the size of the directory, which alerts above its size threshold.")
+	outputPtr := flag.String("output", "", "Also print the state of every checked disk to stdout: json for one JSON object per disk, or table for a table after every check. Logs go to stderr then.")
+	logFormatPtr := flag.String("log-format", "text", "Format of log lines on stdout: text or json.")
+	quietPtr := flag.Bool("quiet", false, "Log checked disks and sent reports at debug level, so only warnings and errors are shown.")
+	logLevelPtr := flag.String("log-level", "info", "Minimum level of log lines: debug, info, warn or error.")
+	flag.String("hostname", "", "Machine name used in reports instead of the kernel hostname. Falls back to DISKSPACE_HOSTNAME.")
+	separatorPtr := flag.String("separator", "", "Separator of -disk and -threshold values, e.g. \",\" or \";\". Whitespace when empty. Quote values containing it, e.g. '\"/mnt/my data\" /'.")
+	expectReadOnlyPtr := flag.String("expect-readonly", "", "Disks that are mounted read-only on purpose, separated by comma, e.g. \"/boot,/snap\". Other read-only disks alert regardless of their threshold.")
+	ignorePtr := flag.String("ignore", "", "Disks to skip, separated by comma, e.g. \"/tmp,/var/cache\". A trailing slash doesn't matter.")
+	minSizePtr := flag.String("min-size", "", "Skip filesystems smaller than this size, e.g. 1G.")
+	noDedupePtr := flag.Bool("no-dedupe", false, "Report every disk on its own, even if several are on the same filesystem.")
+	excludeFSTypePtr := flag.String("exclude-fstype", "", "Filesystem types to skip, separated by comma, e.g. \"tmpfs,overlay,squashfs\".")
+	metricsAddrPtr := flag.String("metrics-addr", "", "Serve Prometheus metrics of the checked disks on this address (e.g. :9100) at /metrics.")
+	healthAddrPtr := flag.String("health-addr", "", "With -interval, serve /healthz and /readyz for liveness and readiness probes on this address (e.g. :8080). Shares the server of -metrics-addr if both are the same.")
+	templatePtr := flag.String("template", "", "Go text/template of the alert message with access to all disk fields and .Threshold, e.g. \"{{.Name}} on {{.Host}}: {{bytes .Free}} free\". Overrides the template config key.")
+	colorPtr := flag.String("color", "auto", "Color -list and -dry-run output by severity: auto (when stdout is a terminal and NO_COLOR is unset), always or never.")
+	summaryOnlyPtr := flag.Bool("summary-only", false, "Send a single message per check to -target instead of a report per disk, counting the healthy disks and listing the breached ones with their free space. Supported by the slack, email and stdout notifiers.")
+	verboseFooterPtr := flag.Bool("verbose-footer", false, "End every report with the time of the check, the version and how many disks were checked and are alerting.")
+	reportAlwaysPtr := flag.Bool("report-always", false, "Send a report for every disk, OK-styled for the ones within their threshold, e.g. for a daily summary.")
+	continueOnNotifyErrorPtr := flag.Bool("continue-on-notify-error", true, "Keep sending the remaining reports and notifiers after one failed. With =false no further report is started after the first failure, and -interval exits 2 after that check.")
+	failOnUnreadablePtr := flag.Bool("fail-on-unreadable", false, "Exit 2 if any disk couldn't be stat'ed, e.g. a vanished mount, after checking the others. By default such disks are logged and skipped.")
+	listPtr := flag.Bool("list", false, "Print the usage of every disk as a table regardless of thresholds, without sending a report.")
+	checkPtr := flag.Bool("check", false, "Check that every disk can be stat'ed and the Slack token is valid without sending a report.")
+	checkModePtr := flag.String("check-mode", "", "Run as a monitoring plugin without sending a report: nagios prints a single status line with performance data and exits 0 (OK), 1 (WARNING), 2 (CRITICAL) or 3 (UNKNOWN) for the worst disk.")
+	versionPtr := flag.Bool("version", false, "Print the version and exit.")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage of %s:\n", os.Args[0])
+		flag.PrintDefaults()
+		fmt.Fprint(flag.CommandLine.Output(), "\nExit codes:\n"+
+			"  0  No disk is below its threshold\n"+
+			"  1  At least one disk is below its threshold or unexpectedly read-only\n"+
+			"  2  Invalid configuration, a report couldn't be sent, or with -fail-on-unreadable a disk couldn't be checked\n"+
+			"  3  The run didn't finish within -max-runtime\n")
+	}
 	flag.Parse()
 
-	diskNames := strings.Fields(*diskNamePtr)
-	thresholdValuesStr := strings.Fields(*thresholdPtr)
+	if *versionPtr {
+		fmt.Printf("diskspace2slack %s (commit %s, built %s)\n", version, commit, date)
+		return
+	}
+
+	// Load the env file first, every environment variable is resolved from here on
+	if *envFilePtr != "" {
+		if err := LoadEnvFile(*envFilePtr); err != nil {
+			fmt.Fprintf(os.Stderr, "Couldn't load env file: %v\n", err)
+			os.Exit(2)
+		}
+	}
+
+	var logLevel slog.Level
+	if err := logLevel.UnmarshalText([]byte(*logLevelPtr)); err != nil {
+		fmt.Fprintf(os.Stderr, "Unknown log level %q: must be debug, info, warn or error.\n", *logLevelPtr)
+		os.Exit(2)
+	}
+	if *quietPtr {
+		routineLevel = slog.LevelDebug
+	}
+	logOptions := &slog.HandlerOptions{Level: logLevel}
+	// Keep stdout clean for -output
+	logOutput := os.Stdout
+	switch *outputPtr {
+	case "":
+	case "json", "table":
+		logOutput = os.Stderr
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown output %q: must be json or table.\n", *outputPtr)
+		os.Exit(2)
+	}
+	switch *checkModePtr {
+	case "":
+	case "nagios":
+		logOutput = os.Stderr
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown check mode %q: must be nagios.\n", *checkModePtr)
+		os.Exit(2)
+	}
+	switch *logFormatPtr {
+	case "text":
+		slog.SetDefault(slog.New(slog.NewTextHandler(logOutput, logOptions)))
+	case "json":
+		slog.SetDefault(slog.New(slog.NewJSONHandler(logOutput, logOptions)))
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown log format %q: must be text or json.\n", *logFormatPtr)
+		os.Exit(2)
+	}
+
+	if *byteFormatPtr != "short" && *byteFormatPtr != "long" {
+		fmt.Fprintf(os.Stderr, "Unknown byte format %q: must be short or long.\n", *byteFormatPtr)
+		os.Exit(2)
+	}
+	switch *percentageBasisPtr {
+	case "total", "df":
+		diskspace.PercentageBasis = *percentageBasisPtr
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown percentage basis %q: must be total or df.\n", *percentageBasisPtr)
+		os.Exit(2)
+	}
+	diskspace.ThousandsSeparator = *thousandsSeparatorPtr
+	switch *unitsPtr {
+	case "iec":
+		diskspace.FormatBytes = diskspace.ByteSize
+		if *byteFormatPtr == "long" {
+			diskspace.FormatBytes = diskspace.ByteSizeLong
+		}
+	case "si":
+		diskspace.FormatBytes = diskspace.ByteSizeSI
+		if *byteFormatPtr == "long" {
+			diskspace.FormatBytes = diskspace.ByteSizeSILong
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown units %q: must be iec or si.\n", *unitsPtr)
+		os.Exit(2)
+	}
+
+	color, err := UseColor(*colorPtr, os.Stdout)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	// Select the notifiers, for Slack use the webhook first and the API token otherwise
+	var notifiers []NamedNotifier
+	var errorReporter *SlackNotifier
+	if *dryRunPtr || *checkModePtr != "" {
+		*notifierPtr = "stdout"
+	}
+	for _, notifierName := range strings.Split(*notifierPtr, ",") {
+		notifierName = strings.TrimSpace(notifierName)
+		var notifier Notifier
+		switch notifierName {
+		case "stdout":
+			notifier = StdoutNotifier{Out: logOutput, Color: color && logOutput == os.Stdout, Critical: *criticalPtr}
+		case "slack":
+			slackNotifier := &SlackNotifier{Token: os.Getenv("SLACK_SECRET_KEY"), WebhookURL: envFallback(*webhookPtr, "SLACK_WEBHOOK_URL"), Critical: *criticalPtr, Timeout: *slackTimeoutPtr, Attempts: *slackRetriesPtr,
+				Username: *slackUsernamePtr, IconEmoji: *slackIconEmojiPtr, IconURL: *slackIconURLPtr, Mention: *mentionPtr, Thread: *threadPtr}
+			if *slackTokenFilePtr != "" {
+				token, err := ReadSecretFile(*slackTokenFilePtr)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Couldn't read Slack token file: %v\n", err)
+					os.Exit(2)
+				}
+				slackNotifier.Token = token
+			}
+			if slackNotifier.WebhookURL == "" && slackNotifier.Token == "" {
+				fmt.Fprintln(os.Stderr, "No Slack credentials: set -webhook, SLACK_WEBHOOK_URL, -slack-token-file or SLACK_SECRET_KEY.")
+				os.Exit(2)
+			}
+			if *proxyPtr != "" {
+				proxyURL, err := url.Parse(*proxyPtr)
+				if err != nil || proxyURL.Host == "" {
+					fmt.Fprintf(os.Stderr, "Invalid proxy URL %q.\n", *proxyPtr)
+					os.Exit(2)
+				}
+				transport := http.DefaultTransport.(*http.Transport).Clone()
+				transport.Proxy = http.ProxyURL(proxyURL)
+				slackNotifier.HTTPClient = &http.Client{Transport: transport}
+			}
+			if slackNotifier.Thread && slackNotifier.WebhookURL != "" {
+				fmt.Fprintln(os.Stderr, "-thread needs SLACK_SECRET_KEY, webhooks can't reply in threads.")
+				os.Exit(2)
+			}
+			// Errors go to -error-channel without threads or mentions, webhooks can't choose their channel
+			if *errorChannelPtr != "" {
+				if slackNotifier.Token == "" {
+					fmt.Fprintln(os.Stderr, "-error-channel needs SLACK_SECRET_KEY or -slack-token-file, webhooks post to a fixed channel.")
+					os.Exit(2)
+				}
+				errorReporter = &SlackNotifier{Token: slackNotifier.Token, Critical: slackNotifier.Critical, Timeout: slackNotifier.Timeout, Attempts: slackNotifier.Attempts,
+					Username: slackNotifier.Username, IconEmoji: slackNotifier.IconEmoji, IconURL: slackNotifier.IconURL, HTTPClient: slackNotifier.HTTPClient}
+			}
+			notifier = slackNotifier
+		case "email":
+			emailNotifier := &EmailNotifier{
+				Host:     envFallback(*smtpHostPtr, "SMTP_HOST"),
+				Port:     envFallback(*smtpPortPtr, "SMTP_PORT"),
+				Username: envFallback(*smtpUsernamePtr, "SMTP_USERNAME"),
+				Password: envFallback(*smtpPasswordPtr, "SMTP_PASSWORD"),
+				From:     envFallback(*emailFromPtr, "EMAIL_FROM"),
+				StartTLS: *smtpStartTLSPtr,
+			}
+			if emailNotifier.Port == "" {
+				emailNotifier.Port = "587"
+			}
+			for _, to := range strings.Split(envFallback(*emailToPtr, "EMAIL_TO"), ",") {
+				if to = strings.TrimSpace(to); to != "" {
+					emailNotifier.To = append(emailNotifier.To, to)
+				}
+			}
+			if emailNotifier.Host == "" || emailNotifier.From == "" || len(emailNotifier.To) == 0 {
+				fmt.Fprintln(os.Stderr, "Email notifier needs -smtp-host, -email-from and -email-to.")
+				os.Exit(2)
+			}
+			notifier = emailNotifier
+		case "pagerduty":
+			pagerDutyNotifier := &PagerDutyNotifier{RoutingKey: envFallback(*pagerDutyKeyPtr, "PAGERDUTY_ROUTING_KEY"), Critical: *criticalPtr}
+			if pagerDutyNotifier.RoutingKey == "" {
+				fmt.Fprintln(os.Stderr, "No PagerDuty routing key: set -pagerduty-key or PAGERDUTY_ROUTING_KEY.")
+				os.Exit(2)
+			}
+			notifier = pagerDutyNotifier
+		case "teams":
+			teamsNotifier := &TeamsNotifier{WebhookURL: envFallback(*teamsWebhookPtr, "TEAMS_WEBHOOK_URL"), Critical: *criticalPtr}
+			if err := ValidateHTTPSURL(teamsNotifier.WebhookURL); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(2)
+			}
+			notifier = teamsNotifier
+		case "discord":
+			discordNotifier := &DiscordNotifier{WebhookURL: envFallback(*discordWebhookPtr, "DISCORD_WEBHOOK_URL"), Critical: *criticalPtr}
+			if err := ValidateHTTPSURL(discordNotifier.WebhookURL); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(2)
+			}
+			notifier = discordNotifier
+		case "http":
+			httpNotifier := &HTTPNotifier{URL: *httpURLPtr, Header: make(http.Header)}
+			if u, err := url.Parse(httpNotifier.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				fmt.Fprintf(os.Stderr, "Invalid -http-url %q: must be an http:// or https:// URL.\n", httpNotifier.URL)
+				os.Exit(2)
+			}
+			for _, header := range httpHeaders {
+				key, value, err := ParseHeader(header)
+				if err != nil {
+					fmt.Fprintln(os.Stderr, err)
+					os.Exit(2)
+				}
+				httpNotifier.Header.Add(key, value)
+			}
+			if *httpTemplatePtr != "" {
+				var err error
+				httpNotifier.Template, err = ParseHTTPTemplate(*httpTemplatePtr)
+				if err != nil {
+					fmt.Fprintln(os.Stderr, err)
+					os.Exit(2)
+				}
+			}
+			notifier = httpNotifier
+		default:
+			fmt.Fprintf(os.Stderr, "Unknown notifier %q: must be slack, email, pagerduty, teams, discord, http or stdout.\n", notifierName)
+			os.Exit(2)
+		}
+		notifiers = append(notifiers, NamedNotifier{Name: notifierName, Notifier: notifier})
+	}
+
+	if *errorChannelPtr != "" && errorReporter == nil && !*dryRunPtr && *checkModePtr == "" {
+		fmt.Fprintln(os.Stderr, "-error-channel needs the slack notifier.")
+		os.Exit(2)
+	}
+
+	var separator rune
+	switch runes := []rune(*separatorPtr); len(runes) {
+	case 0:
+	case 1:
+		separator = runes[0]
+	default:
+		fmt.Fprintf(os.Stderr, "Invalid separator %q: must be a single character.\n", *separatorPtr)
+		os.Exit(2)
+	}
+
+	// Resolve the disks from the flags, environment and config file
+	var config Config
+	if *configPtr != "" {
+		var err error
+		config, err = LoadConfig(*configPtr)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		if *templatePtr == "" {
+			*templatePtr = config.Template
+		}
+	}
+	cooldownExempt := config.CooldownExempt
+	diskData, err := resolveDisks(flag.CommandLine, config, separator, len(repeatedDisks) > 0)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	// Repeated -d disks replace the same path of -disk or -config
+	for diskName, diskConfig := range repeatedDisks {
+		diskData[diskName] = diskConfig
+	}
+
+	// Directories are measured as listed, their thresholds are maximum sizes
+	if *modePtr != "fs" && *modePtr != "dir" {
+		fmt.Fprintf(os.Stderr, "Unknown mode %q: must be fs or dir.\n", *modePtr)
+		os.Exit(2)
+	}
+	if *modePtr == "dir" {
+		for diskName, diskConfig := range diskData {
+			if isDiskPattern(diskName) {
+				fmt.Fprintf(os.Stderr, "Invalid disk %q: -mode dir measures listed directories, not patterns.\n", diskName)
+				os.Exit(2)
+			}
+			if !diskConfig.Threshold.Absolute || diskConfig.Threshold.HasCritical {
+				fmt.Fprintf(os.Stderr, "Invalid threshold %s for %s: -mode dir needs a maximum size like 5G.\n", diskConfig.Threshold, diskName)
+				os.Exit(2)
+			}
+		}
+	}
+
+	// Expand globs and `all` into concrete paths
+	diskData, err = ExpandDisks(diskData)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	// Drop ignored disks before checking any, -inclusive applies to the others
+	ignored := ParseIgnoreList(*ignorePtr)
+	for diskName, diskConfig := range diskData {
+		if ignored[normalizePath(diskName)] {
+			delete(diskData, diskName)
+			continue
+		}
+		if *inclusivePtr {
+			diskConfig.Threshold.Inclusive = true
+			diskData[diskName] = diskConfig
+		}
+	}
+
+	// Apply per-disk targets unless the config file already set one, which takes precedence over -target-map
+	targetMap, err := ParseTargetMap(*targetMapPtr)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	for path, target := range targetMap {
+		diskName, ok := diskByPath(diskData, path)
+		if !ok {
+			slog.Warn("No disk matches -target-map path, ignoring it", "path", path, "target", target)
+			continue
+		}
+		if diskConfig := diskData[diskName]; diskConfig.Target == "" {
+			diskConfig.Target = target
+			diskData[diskName] = diskConfig
+		}
+	}
+
+	// Compact reports lead with Slack emoji unless the labels are set explicitly
+	switch *messageStylePtr {
+	case "verbose":
+	case "compact":
+		if *templatePtr != "" {
+			fmt.Fprintln(os.Stderr, "-message-style compact can't be combined with a custom template.")
+			os.Exit(2)
+		}
+		if !flagSet("crit-label") {
+			*critLabelPtr = ":red_circle:"
+		}
+		if !flagSet("warn-label") {
+			*warnLabelPtr = ":warning:"
+		}
+		if !flagSet("ok-label") {
+			*okLabelPtr = ":white_check_mark:"
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown message style %q: must be verbose or compact.\n", *messageStylePtr)
+		os.Exit(2)
+	}
+	diskspace.MessageStyle = *messageStylePtr
+	diskspace.Labels = map[string]string{"danger": *critLabelPtr, "warning": *warnLabelPtr, "good": *okLabelPtr}
+
+	// Apply labels the same way unless the config file already set one
+	for path, label := range labels {
+		diskName, ok := diskByPath(diskData, path)
+		if !ok {
+			slog.Warn("No disk matches -label path, ignoring it", "path", path, "label", label)
+			continue
+		}
+		if diskConfig := diskData[diskName]; diskConfig.Label == "" {
+			diskConfig.Label = label
+			diskData[diskName] = diskConfig
+		}
+	}
+
+	// Report template errors now rather than when the first report is sent
+	if *templatePtr != "" {
+		diskspace.ReportTemplate, err = diskspace.ParseTemplate(*templatePtr)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+	}
+
+	// A single notifier without cooldown is used as is, otherwise alerts go through a MultiNotifier
+	for _, name := range cooldownExempt {
+		found := false
+		for i := range notifiers {
+			if notifiers[i].Name == name {
+				notifiers[i].IgnoreCooldown = true
+				found = true
+			}
+		}
+		if !found {
+			fmt.Fprintf(os.Stderr, "Invalid cooldown_exempt %q: not one of -notifier.\n", name)
+			os.Exit(2)
+		}
+	}
+	if *summaryOnlyPtr {
+		for _, named := range notifiers {
+			if _, ok := named.Notifier.(SummaryNotifier); !ok {
+				fmt.Fprintf(os.Stderr, "-summary-only isn't supported by the %s notifier.\n", named.Name)
+				os.Exit(2)
+			}
+		}
+	}
+	notifier := notifiers[0].Notifier
+	if len(notifiers) > 1 || *cooldownPtr > 0 {
+		notifier = &MultiNotifier{Notifiers: notifiers, Cooldown: &Cooldown{Duration: *cooldownPtr}, StopOnError: !*continueOnNotifyErrorPtr}
+	}
+
+	hostname, _ := resolveSetting(flag.CommandLine, "hostname", "DISKSPACE_HOSTNAME")
+	monitor := &Monitor{Disks: diskData, Hostname: ResolveHostname(hostname), DefaultTarget: *targetPtr, Notifier: notifier, Batch: *batchPtr, GroupByHost: *groupByHostPtr, ExcludeFSTypes: make(map[string]bool), ExpectReadOnly: ParseIgnoreList(*expectReadOnlyPtr), PrintJSON: *outputPtr == "json", PrintTable: *outputPtr == "table", ReportAlways: *reportAlwaysPtr, VerboseFooter: *verboseFooterPtr, SummaryOnly: *summaryOnlyPtr, Version: version, MaxConcurrency: *maxConcurrencyPtr, StopOnNotifyError: !*continueOnNotifyErrorPtr, DirMode: *modePtr == "dir", Color: color, Critical: *criticalPtr, Dedupe: !*noDedupePtr, RemindAfter: *remindAfterPtr}
+	if *growthAlertPtr != "" {
+		monitor.GrowthAlert, err = diskspace.ParseGrowthRate(*growthAlertPtr)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+	}
+	monitor.PredictWindow = *predictWindowPtr
+	monitor.GrowthSamples = *growthSamplesPtr
+	if *minSizePtr != "" {
+		monitor.MinSize, err = diskspace.ParseByteSize(*minSizePtr)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+	}
+	for _, fsType := range strings.Split(*excludeFSTypePtr, ",") {
+		if fsType = strings.TrimSpace(fsType); fsType != "" {
+			monitor.ExcludeFSTypes[fsType] = true
+		}
+	}
+
+	// Exit with the stats and reports still in progress once the run takes longer than -max-runtime,
+	// regardless of whether a single call hangs within its own timeout or not
+	if *maxRuntimePtr > 0 {
+		if *intervalPtr > 0 {
+			fmt.Fprintln(os.Stderr, "-max-runtime only applies to single runs, use -health-addr to detect stuck polls with -interval.")
+			os.Exit(2)
+		}
+		time.AfterFunc(*maxRuntimePtr, func() {
+			slog.Error("Run exceeded the maximum runtime, exiting", "max_runtime", maxRuntimePtr.String(), "pending", strings.Join(monitor.Pending(), ", "))
+			os.Exit(3)
+		})
+	}
+
+	if *listPtr {
+		if errs := monitor.List(os.Stdout); len(errs) > 0 {
+			for _, err := range errs {
+				slog.Error("Couldn't list disk", "error", err)
+			}
+			os.Exit(2)
+		}
+		return
+	}
 
-	// Convert threshold values to integers
-	thresholdValues := MapStrToInt(thresholdValuesStr)
+	if *checkModePtr == "nagios" {
+		os.Exit(monitor.NagiosCheck(os.Stdout))
+	}
 
-	// Check if diskNames and thresholdValues contain the same amount of values
-	if len(diskNames) != len(thresholdValues) {
-		panic("-disk and -threshold arguments need to have same amount of values!")
+	if *checkPtr {
+		if !monitor.SelfTest(context.Background(), os.Stdout) {
+			os.Exit(2)
+		}
+		return
 	}
 
-	// Create a map from diskNames and thresholdValues
-	var diskData map[string]uint64
-	diskData = make(map[string]uint64)
-	for i, v := range diskNames {
-		diskData[v] = thresholdValues[i]
+	if *healthAddrPtr != "" && *intervalPtr == 0 {
+		fmt.Fprintln(os.Stderr, "-health-addr needs -interval, there is nothing to probe in a single run.")
+		os.Exit(2)
 	}
 
-	// Create WaitGroup for async workflow
-	var wg sync.WaitGroup
-	for diskName, thresholdValue := range diskData {
-		disk, err := StatDisk(diskName)
+	// Serve the metrics of every check and the health of the daemon loop in the background,
+	// on a single server if both addresses are the same
+	var health *Health
+	muxes := make(map[string]*http.ServeMux)
+	serve := func(addr string) *http.ServeMux {
+		if mux, ok := muxes[addr]; ok {
+			return mux
+		}
+		listener, err := net.Listen("tcp", addr)
 		if err != nil {
-			panic(err)
+			fmt.Fprintf(os.Stderr, "Couldn't listen on %s: %v\n", addr, err)
+			os.Exit(2)
+		}
+		mux := http.NewServeMux()
+		muxes[addr] = mux
+		go http.Serve(listener, mux)
+		return mux
+	}
+	if *metricsAddrPtr != "" {
+		monitor.Metrics = NewMetrics()
+		serve(*metricsAddrPtr).Handle("/metrics", monitor.Metrics)
+	}
+	if *healthAddrPtr != "" {
+		health = NewHealth(*intervalPtr)
+		health.Register(serve(*healthAddrPtr))
+	}
+
+	// On the first SIGINT/SIGTERM stop starting reports and let the pending ones finish,
+	// exit right away on a second signal or once the shutdown timeout has passed
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		slog.Info("Received signal, finishing pending reports", "signal", sig.String(), "timeout", shutdownTimeoutPtr.String())
+		cancel()
+		select {
+		case sig = <-signals:
+			slog.Warn("Received second signal, exiting without waiting for pending reports", "signal", sig.String())
+		case <-time.After(*shutdownTimeoutPtr):
+			slog.Warn("Pending reports didn't finish within the shutdown timeout, exiting")
 		}
-		if disk.FreePercentage < thresholdValue {
-			// Increment the WaitGroup counter.
-			wg.Add(1)
-			go SendDiskSpaceReport(disk, thresholdValue, *targetPtr, &wg)
+		os.Exit(2)
+	}()
+
+	if *stateFilePtr != "" {
+		monitor.LoadState(*stateFilePtr)
+	}
+	saveState := func() {
+		if *stateFilePtr == "" {
+			return
+		}
+		if err := monitor.SaveState(*stateFilePtr); err != nil {
+			slog.Error("Couldn't save state file", "path", *stateFilePtr, "error", err)
+		}
+	}
+
+	// Trace every check if an OTLP endpoint is configured, flushing the spans before exiting
+	shutdownTracing, err := SetupTracing(context.Background())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Couldn't set up tracing: %v\n", err)
+		os.Exit(2)
+	}
+	flushTraces := func() {
+		flushCtx, flushCancel := context.WithTimeout(context.Background(), *shutdownTimeoutPtr)
+		defer flushCancel()
+		if err := shutdownTracing(flushCtx); err != nil {
+			slog.Error("Couldn't flush traces", "error", err)
 		}
 	}
-	// Wait for all Slack reports to be sent.
-	wg.Wait()
+
+	// Run once, or keep polling every interval in daemon mode
+	if *intervalPtr == 0 {
+		result := monitor.Check(ctx)
+		saveState()
+		PostCheckErrors(ctx, errorReporter, *errorChannelPtr, monitor.Hostname, result)
+		flushTraces()
+		if PrintReportErrors(result.Reports, result.Errors) {
+			os.Exit(2)
+		}
+		if *failOnUnreadablePtr && len(result.StatErrors) > 0 {
+			slog.Error("Some disks couldn't be checked", "failed", len(result.StatErrors), "total", len(monitor.Disks))
+			os.Exit(2)
+		}
+		if result.Breached > 0 {
+			os.Exit(1)
+		}
+		return
+	}
+
+	monitor.Run(ctx, *intervalPtr, func(result CheckResult) {
+		saveState()
+		PrintReportErrors(result.Reports, result.Errors)
+		PostCheckErrors(ctx, errorReporter, *errorChannelPtr, monitor.Hostname, result)
+		if health != nil {
+			health.Polled(time.Now(), len(result.Errors) == 0 && !(*failOnUnreadablePtr && len(result.StatErrors) > 0))
+		}
+		if !*continueOnNotifyErrorPtr && len(result.Errors) > 0 {
+			slog.Error("Stopping after a failed report", "failed", len(result.Errors))
+			flushTraces()
+			os.Exit(2)
+		}
+	})
+	flushTraces()
 }
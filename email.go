@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// EmailNotifier sends alerts via SMTP to every address in To.
+// StartTLS upgrades the connection before authenticating, as required by most submission servers on port 587.
+// Connecting and delivering give up after Timeout, or defaultHTTPTimeout if it is zero, or earlier when ctx is done.
+type EmailNotifier struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+	To       []string
+	StartTLS bool
+	Timeout  time.Duration
+}
+
+// emailSubjectTags are the subject tags of email alerts by Severity
+var emailSubjectTags = map[string]string{
+	"danger":  "[CRITICAL]",
+	"warning": "[WARNING]",
+	"good":    "[OK]",
+}
+
+// emailSubject returns the subject line for alert, e.g. `[WARNING] Low disk space on host:/path`
+func emailSubject(alert Alert) string {
+	if alert.Recovered {
+		return fmt.Sprintf("[RECOVERED] Disk space back on %s:%s", alert.Disk.Host, alert.Disk.Name)
+	}
+	tag := emailSubjectTags[Severity(alert, alert.Critical)]
+	return fmt.Sprintf("%s %s on %s:%s", tag, alert.Problem(), alert.Disk.Host, alert.Disk.Name)
+}
+
+// Notify sends alert as a plain text email
+func (n *EmailNotifier) Notify(ctx context.Context, alert Alert) error {
+	return n.send(ctx, emailSubject(alert), alert.Message(), alert.LogAttrs())
+}
+
+// NotifySummary sends summary as a single plain text email, target is ignored in favor of To
+func (n *EmailNotifier) NotifySummary(ctx context.Context, target string, summary RunSummary) error {
+	status := "[OK]"
+	if len(summary.Breached) > 0 {
+		status = "[WARNING]"
+	}
+	subject := fmt.Sprintf("%s Disk summary for %s: %s", status, summary.Host, summary.Counts())
+	return n.send(ctx, subject, summary.Text(), []any{"checked", summary.Checked, "breached", len(summary.Breached)})
+}
+
+// send delivers a plain text email with subject and body to every address in To
+func (n *EmailNotifier) send(ctx context.Context, subject string, body string, logAttrs []any) error {
+	addr := net.JoinHostPort(n.Host, n.Port)
+	timeout := n.Timeout
+	if timeout <= 0 {
+		timeout = defaultHTTPTimeout
+	}
+	dialer := net.Dialer{Timeout: timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return fmt.Errorf("Couldn't connect to SMTP server %s: %v", addr, err)
+	}
+	// A server that stops responding mid-session must not hang the report
+	deadline := time.Now().Add(timeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	conn.SetDeadline(deadline)
+	client, err := smtp.NewClient(conn, n.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("Couldn't connect to SMTP server %s: %v", addr, err)
+	}
+	defer client.Close()
+
+	if n.StartTLS {
+		if err := client.StartTLS(&tls.Config{ServerName: n.Host}); err != nil {
+			return fmt.Errorf("STARTTLS with %s failed: %v", addr, err)
+		}
+	}
+	if n.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", n.Username, n.Password, n.Host)); err != nil {
+			return fmt.Errorf("SMTP authentication with %s failed: %v", addr, err)
+		}
+	}
+	if err := client.Mail(n.From); err != nil {
+		return err
+	}
+	for _, to := range n.To {
+		if err := client.Rcpt(to); err != nil {
+			return fmt.Errorf("Recipient %s rejected: %v", to, err)
+		}
+	}
+
+	var message bytes.Buffer
+	fmt.Fprintf(&message, "From: %s\r\n", n.From)
+	fmt.Fprintf(&message, "To: %s\r\n", strings.Join(n.To, ", "))
+	fmt.Fprintf(&message, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&message, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&message, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&message, "Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	message.WriteString(strings.Replace(body, "\n", "\r\n", -1))
+	message.WriteString("\r\n")
+
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(message.Bytes()); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	logRoutine("Email sent", append(logAttrs, "to", strings.Join(n.To, ", "))...)
+	return client.Quit()
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/danthelion/diskspace2slack/diskspace"
+)
+
+// allDisks is the -disk entry that expands to every mount point
+const allDisks = "all"
+
+// isDiskPattern reports whether name is `all` or a local shell-style glob like /mnt/data*
+func isDiskPattern(name string) bool {
+	if name == allDisks {
+		return true
+	}
+	if _, _, remote := diskspace.SplitRemoteDisk(name); remote {
+		return false
+	}
+	return strings.ContainsAny(name, "*?[")
+}
+
+// expandDiskPattern returns the paths matching pattern, every mount point for `all`
+func expandDiskPattern(pattern string) ([]string, error) {
+	if pattern == allDisks {
+		return diskspace.MountPoints()
+	}
+	return filepath.Glob(pattern)
+}
+
+// filesystemOf identifies the filesystem of a local path by its mount point, falling back to the path itself
+func filesystemOf(path string) string {
+	if mountPoint, _ := diskspace.MountOf(path); mountPoint != "" {
+		return mountPoint
+	}
+	return path
+}
+
+// ExpandDisks replaces glob patterns and `all` in disks with the paths they match, each with the config of its pattern.
+// Disks listed explicitly are always kept, while a matched path is dropped if its filesystem is already checked.
+func ExpandDisks(disks map[string]DiskConfig) (map[string]DiskConfig, error) {
+	expanded := make(map[string]DiskConfig)
+	filesystems := make(map[string]bool)
+	var patterns []string
+	for diskName, diskConfig := range disks {
+		if isDiskPattern(diskName) {
+			patterns = append(patterns, diskName)
+			continue
+		}
+		expanded[diskName] = diskConfig
+		if _, _, remote := diskspace.SplitRemoteDisk(diskName); !remote {
+			filesystems[filesystemOf(diskName)] = true
+		}
+	}
+	// Expand in a fixed order so the same path wins every time
+	sort.Strings(patterns)
+	for _, pattern := range patterns {
+		paths, err := expandDiskPattern(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid disk pattern %q: %v", pattern, err)
+		}
+		if len(paths) == 0 {
+			slog.Warn("No disks match pattern", "pattern", pattern)
+		}
+		for _, path := range paths {
+			filesystem := filesystemOf(path)
+			if _, ok := expanded[path]; ok || filesystems[filesystem] {
+				slog.Debug("Skipping path on an already checked filesystem", "pattern", pattern, "path", path, "mount", filesystem)
+				continue
+			}
+			filesystems[filesystem] = true
+			expanded[path] = disks[pattern]
+		}
+	}
+	return expanded, nil
+}
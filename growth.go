@@ -0,0 +1,66 @@
+package main
+
+import (
+	"time"
+
+	"github.com/danthelion/diskspace2slack/diskspace"
+)
+
+// maxTimeToFull is the longest projected time until a disk is full
+const maxTimeToFull = 100 * 365 * 24 * time.Hour
+
+// growthSample is the free space of a disk at one check
+type growthSample struct {
+	at   time.Time
+	free uint64
+}
+
+// growthTracker keeps the last samples of free space of every disk as a ring buffer, kept in memory only
+type growthTracker struct {
+	samples map[string][]growthSample
+	size    int
+}
+
+// newGrowthTracker returns a growthTracker keeping size samples per disk
+func newGrowthTracker(size int) *growthTracker {
+	if size < 2 {
+		size = 2
+	}
+	return &growthTracker{samples: make(map[string][]growthSample), size: size}
+}
+
+// Add records the free space of the disk key at time at and returns the growth across its samples,
+// the slope of a least squares fit of free space over time. It reports false until there are at least two samples.
+func (t *growthTracker) Add(key string, free uint64, at time.Time) (diskspace.Growth, bool) {
+	samples := append(t.samples[key], growthSample{at: at, free: free})
+	if len(samples) > t.size {
+		samples = samples[len(samples)-t.size:]
+	}
+	t.samples[key] = samples
+
+	oldest, newest := samples[0], samples[len(samples)-1]
+	if len(samples) < 2 || !newest.at.After(oldest.at) {
+		return diskspace.Growth{}, false
+	}
+	// Fit relative to the oldest sample, so that seconds and byte counts stay small enough for float64
+	var meanX, meanY float64
+	for _, sample := range samples {
+		meanX += sample.at.Sub(oldest.at).Seconds()
+		meanY += float64(sample.free) - float64(oldest.free)
+	}
+	meanX /= float64(len(samples))
+	meanY /= float64(len(samples))
+	var covariance, variance float64
+	for _, sample := range samples {
+		dx := sample.at.Sub(oldest.at).Seconds() - meanX
+		covariance += dx * (float64(sample.free) - float64(oldest.free) - meanY)
+		variance += dx * dx
+	}
+	growth := diskspace.Growth{BytesPerSecond: -covariance / variance}
+	// Stable or growing free space and rates too slow to fill the disk within maxTimeToFull don't get a projection
+	if seconds := float64(newest.free) / growth.BytesPerSecond; growth.Declining() && seconds < maxTimeToFull.Seconds() {
+		growth.TimeToFull = time.Duration(seconds * float64(time.Second)).Round(time.Minute)
+		growth.FullAt = newest.at.Add(growth.TimeToFull)
+	}
+	return growth, true
+}
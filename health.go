@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// healthGracePolls is how many intervals may pass without a completed poll before the daemon counts as unhealthy
+const healthGracePolls = 3
+
+// Health serves the liveness and readiness of the daemon loop for probes like Kubernetes'.
+// /healthz is healthy while a poll completed within the last few intervals, /readyz once a poll succeeded without errors.
+type Health struct {
+	mu       sync.Mutex
+	interval time.Duration
+	lastPoll time.Time
+	ready    bool
+}
+
+// NewHealth returns a Health for a daemon polling every interval, counting as healthy until the first poll is due
+func NewHealth(interval time.Duration) *Health {
+	return &Health{interval: interval, lastPoll: time.Now()}
+}
+
+// Polled records a completed poll cycle at t, a successful one makes the daemon ready
+func (h *Health) Polled(t time.Time, success bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lastPoll = t
+	if success {
+		h.ready = true
+	}
+}
+
+// Register adds the /healthz and /readyz handlers to mux
+func (h *Health) Register(mux *http.ServeMux) {
+	mux.HandleFunc("/healthz", h.serveHealthz)
+	mux.HandleFunc("/readyz", h.serveReadyz)
+}
+
+// serveHealthz answers 200 while the last poll completed recently enough, 503 if the loop seems stuck
+func (h *Health) serveHealthz(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	since := time.Since(h.lastPoll)
+	h.mu.Unlock()
+	if since > healthGracePolls*h.interval {
+		http.Error(w, fmt.Sprintf("last poll completed %s ago", since.Round(time.Second)), http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
+
+// serveReadyz answers 200 once a poll succeeded, 503 before
+func (h *Health) serveReadyz(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	ready := h.ready
+	h.mu.Unlock()
+	if !ready {
+		http.Error(w, "no successful poll yet", http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/danthelion/diskspace2slack/diskspace"
+)
+
+// HTTPNotifier posts alerts as JSON to an arbitrary URL, by default the diskReport of the disk along with whether it recovered.
+// Template replaces the default body when set and Header is added to every request, e.g. for auth tokens.
+// Requests that take longer than Timeout, or defaultHTTPTimeout if it is zero, are aborted.
+type HTTPNotifier struct {
+	URL      string
+	Template *template.Template
+	Header   http.Header
+	Timeout  time.Duration
+}
+
+// httpPayload is the default body of HTTPNotifier
+type httpPayload struct {
+	diskReport
+	Recovered bool `json:"recovered"`
+}
+
+// httpTemplateData is passed to the -http-template, like TemplateData with whether the disk recovered
+type httpTemplateData struct {
+	diskspace.TemplateData
+	Recovered bool
+}
+
+// ParseHTTPTemplate parses text as a request body template. In addition to the report template functions
+// `json` encodes a value as JSON, e.g. {"path": {{json .Name}}}.
+func ParseHTTPTemplate(text string) (*template.Template, error) {
+	funcs := template.FuncMap{"json": func(v any) (string, error) {
+		encoded, err := json.Marshal(v)
+		return string(encoded), err
+	}}
+	tmpl, err := template.New("http").Funcs(diskspace.TemplateFuncs).Funcs(funcs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid HTTP template: %v", err)
+	}
+	if err := tmpl.Execute(io.Discard, httpTemplateData{}); err != nil {
+		return nil, fmt.Errorf("Invalid HTTP template: %v", err)
+	}
+	return tmpl, nil
+}
+
+// ParseHeader parses a header of the form `Key: Value`
+func ParseHeader(s string) (string, string, error) {
+	key, value, ok := strings.Cut(s, ":")
+	if !ok || strings.TrimSpace(key) == "" {
+		return "", "", fmt.Errorf("Invalid header %q: must be Key: Value", s)
+	}
+	return strings.TrimSpace(key), strings.TrimSpace(value), nil
+}
+
+// body renders the request body for alert
+func (n *HTTPNotifier) body(alert Alert) ([]byte, error) {
+	if n.Template == nil {
+		report := diskReport{DiskState: alert.Disk, Threshold: alert.Threshold, Breached: alert.Threshold.Breached(alert.Disk)}
+		return json.Marshal(httpPayload{diskReport: report, Recovered: alert.Recovered})
+	}
+	var body bytes.Buffer
+	data := httpTemplateData{TemplateData: diskspace.TemplateData{DiskState: alert.Disk, Threshold: alert.Threshold, Growth: alert.Growth, OK: alert.OK, Run: alert.Run}, Recovered: alert.Recovered}
+	if err := n.Template.Execute(&body, data); err != nil {
+		return nil, err
+	}
+	return body.Bytes(), nil
+}
+
+// Notify posts alert to URL, any 2xx response counts as success
+func (n *HTTPNotifier) Notify(ctx context.Context, alert Alert) error {
+	body, err := n.body(alert)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, values := range n.Header {
+		req.Header[key] = values
+	}
+	resp, err := timeoutClient(n.Timeout).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		respBody, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("%s returned %s: %s", req.URL.Host, resp.Status, strings.TrimSpace(string(respBody)))
+	}
+	logRoutine("Message sent via HTTP", alert.LogAttrs()...)
+	return nil
+}
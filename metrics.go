@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/danthelion/diskspace2slack/diskspace"
+)
+
+// Metrics exposes the latest DiskState of every checked disk in the Prometheus text format
+type Metrics struct {
+	mu    sync.Mutex
+	disks map[string]diskspace.DiskState
+}
+
+// NewMetrics returns an empty Metrics
+func NewMetrics() *Metrics {
+	return &Metrics{disks: make(map[string]diskspace.DiskState)}
+}
+
+// Update records disk, replacing any previous state of the same host and path
+func (m *Metrics) Update(disk diskspace.DiskState) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.disks[disk.Host+":"+disk.Name] = disk
+}
+
+// labelEscaper escapes label values as required by the Prometheus text format
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// ServeHTTP writes the diskspace_* gauges labeled by host and path
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	keys := make([]string, 0, len(m.disks))
+	for key := range m.disks {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	disks := make([]diskspace.DiskState, len(keys))
+	for i, key := range keys {
+		disks[i] = m.disks[key]
+	}
+	m.mu.Unlock()
+
+	gauges := []struct {
+		name  string
+		help  string
+		value func(diskspace.DiskState) uint64
+	}{
+		{"diskspace_free_bytes", "Free space available to unprivileged users in bytes.", func(d diskspace.DiskState) uint64 { return d.Free }},
+		{"diskspace_total_bytes", "Total size of the filesystem in bytes.", func(d diskspace.DiskState) uint64 { return d.All }},
+		{"diskspace_free_percentage", "Free space in percent of the total size.", func(d diskspace.DiskState) uint64 { return d.FreePercentage }},
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	for _, gauge := range gauges {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", gauge.name, gauge.help, gauge.name)
+		for _, disk := range disks {
+			fmt.Fprintf(w, "%s{host=\"%s\",path=\"%s\"} %d\n", gauge.name, labelEscaper.Replace(disk.Host), labelEscaper.Replace(disk.Name), gauge.value(disk))
+		}
+	}
+}
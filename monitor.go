@@ -0,0 +1,572 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+	"text/tabwriter"
+	"time"
+	"unicode/utf8"
+
+	"github.com/danthelion/diskspace2slack/diskspace"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Monitor checks a set of disks and sends a report for each one below its threshold.
+// It keeps state between checks, so the same Monitor is reused for every poll cycle.
+type Monitor struct {
+	Disks         map[string]DiskConfig
+	DefaultTarget string
+	// Hostname is the machine name of local disks, remote disks are named after their SSH host
+	Hostname string
+	Notifier Notifier
+	// Metrics is updated with every DiskState when set
+	Metrics *Metrics
+	// Batch sends the reports for the same target as one message if Notifier is a BatchNotifier
+	Batch bool
+	// GroupByHost is like Batch but sends one message per host and target
+	GroupByHost bool
+	// ExcludeFSTypes lists filesystem types that are skipped entirely, e.g. tmpfs
+	ExcludeFSTypes map[string]bool
+	// Dedupe reports disks on the same filesystem once, as the first of their paths listing the others as aliases
+	Dedupe bool
+	// ExpectReadOnly holds the normalized paths of disks that are read-only on purpose, other read-only disks alert
+	ExpectReadOnly map[string]bool
+	// MinSize skips filesystems smaller than this many bytes, e.g. boot partitions and loop devices
+	MinSize uint64
+	// DirMode measures every disk with MeasureDir and alerts once a directory grows above its threshold
+	DirMode bool
+	// Stat returns the state of a configured disk by name when set, replacing StatDisk, RemoteStatDisk and MeasureDir,
+	// e.g. to check synthetic disks
+	Stat func(name string) (diskspace.DiskState, error)
+	// Color colors the FREE % column of List by severity, using the Critical percentage like SlackNotifier
+	Color    bool
+	Critical uint64
+	// PrintJSON prints every checked disk to stdout as a diskReport JSON object
+	PrintJSON bool
+	// ReportAlways also reports the disks within their threshold as OK
+	ReportAlways bool
+	// VerboseFooter ends every alert with the RunInfo of its check, showing Version
+	VerboseFooter bool
+	Version       string
+	// SummaryOnly sends a single RunSummary to DefaultTarget per check instead of a report per disk,
+	// if Notifier is a SummaryNotifier
+	SummaryOnly bool
+	// PrintTable prints the checked disks to stdout as a table once their reports are sent
+	PrintTable bool
+	// MaxConcurrency limits how many reports are sent at once, 0 means no limit
+	MaxConcurrency int
+	// StopOnNotifyError starts no further reports of a check once one of them failed, the ones already sending finish
+	StopOnNotifyError bool
+	// RemindAfter suppresses repeated alerts for a disk that stays below its threshold until it elapsed,
+	// 0 alerts on every check. A disk whose severity rose since it alerted, e.g. from warning to danger, alerts right away.
+	RemindAfter time.Duration
+	// GrowthAlert alerts for disks whose free space drops faster than this rate across the last GrowthSamples checks,
+	// a zero rate disables it
+	GrowthAlert   diskspace.GrowthRate
+	GrowthSamples int
+	// PredictWindow alerts for disks projected to be full within it by a linear fit of the last GrowthSamples checks,
+	// 0 disables it
+	PredictWindow time.Duration
+
+	// alerted holds the state of the disks currently below their threshold, keyed by host:path.
+	// It is kept in memory only unless persisted with SaveState, so a restart clears it.
+	alerted map[string]alertState
+	// growth holds the recent free space samples for GrowthAlert and PredictWindow, kept in memory only
+	growth *growthTracker
+	// pending tracks the stats and reports in progress, see Pending
+	pending pendingWork
+}
+
+// pendingWork counts the stats and reports in progress by description
+type pendingWork struct {
+	mu    sync.Mutex
+	items map[string]int
+}
+
+// start marks item as in progress until the returned function is called
+func (p *pendingWork) start(item string) func() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.items == nil {
+		p.items = make(map[string]int)
+	}
+	p.items[item]++
+	return func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if p.items[item]--; p.items[item] == 0 {
+			delete(p.items, item)
+		}
+	}
+}
+
+// Pending returns the stats and reports currently in progress in order, e.g. for the watchdog of -max-runtime
+func (m *Monitor) Pending() []string {
+	m.pending.mu.Lock()
+	defer m.pending.mu.Unlock()
+	items := make([]string, 0, len(m.pending.items))
+	for item := range m.pending.items {
+		items = append(items, item)
+	}
+	sort.Strings(items)
+	return items
+}
+
+// plannedReport is a single message of a Check, sent by send
+type plannedReport struct {
+	// subject names the disk, target or summary the report is about, pending describes it for Pending
+	subject string
+	pending string
+	send    func() error
+}
+
+// CheckResult summarizes a single Check
+type CheckResult struct {
+	// Reports is the number of reports sent, including failed ones
+	Reports int
+	// Breached is the number of disks below their threshold or unexpectedly read-only, including ones not reported again due to RemindAfter
+	Breached int
+	// Errors holds the errors of failed reports
+	Errors []error
+	// StatErrors holds the errors of disks that couldn't be stat'ed, e.g. a vanished mount
+	StatErrors []error
+}
+
+// Check stats every disk and sends a report for each one below its threshold.
+// Disks that alerted on a previous check get a recovery report once they rise above it again,
+// while they stay below it they alert again once RemindAfter elapsed.
+// Disks that can't be stat'ed, e.g. unreachable remote hosts, don't stop the other disks from being checked.
+// It waits for all reports to be sent before returning. Once ctx is done no further reports are started,
+// while the ones already sending are finished.
+func (m *Monitor) Check(ctx context.Context) CheckResult {
+	if m.alerted == nil {
+		m.alerted = make(map[string]alertState)
+	}
+	diskNames := m.sortedDiskNames()
+	started := time.Now()
+	ctx, span := startSpan(ctx, "check", attribute.Int("disks", len(diskNames)))
+	defer span.End()
+
+	// Stat every disk first, so that disks on the same filesystem can be collapsed
+	checked := m.statDisks(ctx, diskNames)
+	disks := checked.disks
+
+	var alerts []Alert
+	// breachedAlerts holds every breached disk for SummaryOnly, including the ones within the remind window
+	var breachedAlerts []Alert
+	// severities holds the alertSeverity of every disk for PrintTable
+	severities := make([]string, len(disks))
+	breached := 0
+	for i, disk := range disks {
+		diskConfig := checked.configs[i]
+		disk.DisplayName = diskConfig.Label
+		if m.Metrics != nil {
+			m.Metrics.Update(disk)
+		}
+		alert := Alert{Disk: disk, Threshold: diskConfig.Threshold, Target: diskConfig.Target, Critical: m.Critical}
+		alert.ReadOnly = disk.ReadOnly && !m.ExpectReadOnly[normalizePath(checked.names[i])]
+		if alert.Target == "" {
+			alert.Target = m.DefaultTarget
+		}
+		logRoutine("Checked disk", alert.LogAttrs()...)
+		severities[i] = alertSeverity(alert, m.Critical)
+		if m.PrintJSON {
+			printDiskReport(alert)
+		}
+		key := disk.Host + ":" + disk.Name
+		growing := false
+		if m.GrowthAlert.Bytes > 0 || m.PredictWindow > 0 {
+			if m.growth == nil {
+				m.growth = newGrowthTracker(m.GrowthSamples)
+			}
+			if growth, ok := m.growth.Add(key, disk.Free, time.Now()); ok {
+				alert.Growth = growth
+				growing = m.GrowthAlert.Bytes > 0 && growth.BytesPerSecond >= m.GrowthAlert.BytesPerSecond()
+				if m.PredictWindow > 0 && growth.TimeToFull > 0 && growth.TimeToFull <= m.PredictWindow {
+					growing = true
+				}
+			}
+		}
+		state, alerted := m.alerted[key]
+		if alert.Threshold.Breached(disk) || growing || alert.ReadOnly {
+			breached++
+			breachedAlerts = append(breachedAlerts, alert)
+			// State saved before severities were kept has none, which doesn't count as an escalation
+			escalated := state.Severity != "" && severityRank[severities[i]] > severityRank[state.Severity]
+			if alerted && m.RemindAfter > 0 && !m.ReportAlways && !escalated && time.Since(state.LastAlert) < m.RemindAfter {
+				slog.Debug("Skipping alert within remind window", "host", disk.Host, "path", disk.Name, "last_alert", state.LastAlert)
+				state.FreePercentage = disk.FreePercentage
+				m.alerted[key] = state
+				continue
+			}
+			m.alerted[key] = alertState{LastAlert: time.Now(), FreePercentage: disk.FreePercentage, Severity: severities[i]}
+		} else if alerted {
+			delete(m.alerted, key)
+			alert.Recovered = true
+		} else if m.ReportAlways {
+			alert.OK = true
+		} else {
+			continue
+		}
+		alerts = append(alerts, alert)
+		for _, target := range checked.extraTargets[i] {
+			folded := alert
+			folded.Target = target
+			alerts = append(alerts, folded)
+		}
+	}
+	sort.Slice(alerts, func(i, j int) bool { return alerts[i].Disk.Name < alerts[j].Disk.Name })
+	if m.VerboseFooter {
+		run := &diskspace.RunInfo{Time: started, Version: m.Version, Checked: len(disks), Alerting: breached}
+		for i := range alerts {
+			alerts[i].Run = run
+		}
+	}
+
+	// Plan the reports first, so that errs can hold an error for every one of them
+	// Reports carry the span of the check but aren't cancelled along with ctx
+	reportCtx := context.WithoutCancel(ctx)
+	var reports []plannedReport
+	if summaryNotifier, ok := m.Notifier.(SummaryNotifier); ok && m.SummaryOnly {
+		// One message for the whole check, even if no disk breached
+		sort.Slice(breachedAlerts, func(i, j int) bool { return breachedAlerts[i].Disk.Name < breachedAlerts[j].Disk.Name })
+		summary := RunSummary{Host: m.Hostname, Checked: len(disks), Breached: breachedAlerts}
+		reports = append(reports, plannedReport{subject: "summary", pending: "summary to " + m.DefaultTarget, send: func() error {
+			return SendSummaryReport(reportCtx, summaryNotifier, m.DefaultTarget, summary)
+		}})
+	} else if batchNotifier, ok := m.Notifier.(BatchNotifier); ok && (m.Batch || m.GroupByHost) {
+		// One message per target, and per host of it with GroupByHost
+		type batchKey struct{ target, host string }
+		byTarget := make(map[batchKey][]Alert)
+		for _, alert := range alerts {
+			key := batchKey{target: alert.Target}
+			if m.GroupByHost {
+				key.host = alert.Disk.Host
+			}
+			byTarget[key] = append(byTarget[key], alert)
+		}
+		for key, targetAlerts := range byTarget {
+			target := key.target
+			reports = append(reports, plannedReport{subject: target, pending: "batch report to " + target, send: func() error {
+				return SendBatchReport(reportCtx, batchNotifier, target, targetAlerts)
+			}})
+		}
+	} else {
+		for _, alert := range alerts {
+			reports = append(reports, plannedReport{subject: alert.Disk.Name, pending: "report for " + alert.Disk.Name + " to " + alert.Target, send: func() error {
+				return SendDiskSpaceReport(reportCtx, m.Notifier, alert)
+			}})
+		}
+	}
+
+	// Create WaitGroup for async workflow
+	var wg sync.WaitGroup
+	// Errors of failed reports, buffered for one per report so no report blocks on it.
+	// With StopOnNotifyError the first one stops starting reports like a shutdown.
+	errs := make(chan error, len(reports))
+	startCtx, stopReports := context.WithCancel(ctx)
+	defer stopReports()
+	collect := func(err error) {
+		if err != nil {
+			errs <- err
+			if m.StopOnNotifyError {
+				stopReports()
+			}
+		}
+	}
+	// Limit the reports in flight to MaxConcurrency
+	var inFlight chan struct{}
+	if m.MaxConcurrency > 0 {
+		inFlight = make(chan struct{}, m.MaxConcurrency)
+	}
+	// acquire reports whether a report may start, which it may not once ctx is done or reports were stopped
+	acquire := func() bool {
+		if startCtx.Err() != nil {
+			return false
+		}
+		if inFlight == nil {
+			return true
+		}
+		select {
+		case inFlight <- struct{}{}:
+			return true
+		case <-startCtx.Done():
+			return false
+		}
+	}
+	skip := func(what string) {
+		if ctx.Err() != nil {
+			collect(fmt.Errorf("Skipped report for %s, shutting down", what))
+			return
+		}
+		collect(fmt.Errorf("Skipped report for %s, a previous report failed", what))
+	}
+	release := func() {
+		if inFlight != nil {
+			<-inFlight
+		}
+	}
+	for _, report := range reports {
+		// Increment the WaitGroup counter.
+		wg.Add(1)
+		go func(report plannedReport) {
+			// Done only after collect, so that no error is sent once errs is closed
+			defer wg.Done()
+			if !acquire() {
+				skip(report.subject)
+				return
+			}
+			defer release()
+			defer m.pending.start(report.pending)()
+			collect(report.send())
+		}(report)
+	}
+	reportCount := len(reports)
+	// Wait for all reports to be sent, then drain their errors
+	wg.Wait()
+	close(errs)
+	var reportErrors []error
+	for err := range errs {
+		reportErrors = append(reportErrors, err)
+	}
+	if m.PrintTable {
+		printDiskTable(os.Stdout, disks, severities, m.Color)
+	}
+	span.SetAttributes(attribute.Int("breached", breached), attribute.Int("reports", reportCount), attribute.Int("errors", len(reportErrors)))
+	return CheckResult{Reports: reportCount, Breached: breached, Errors: reportErrors, StatErrors: checked.errors}
+}
+
+// Run checks the disks every interval until ctx is done, passing the result of every check to polled
+func (m *Monitor) Run(ctx context.Context, interval time.Duration, polled func(CheckResult)) {
+	for {
+		polled(m.Check(ctx))
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// stat returns the state of the disk name using Stat, MeasureDir in DirMode or statDiskByName
+func (m *Monitor) stat(name string) (diskspace.DiskState, error) {
+	switch {
+	case m.Stat != nil:
+		return m.Stat(name)
+	case m.DirMode:
+		return diskspace.MeasureDir(name)
+	default:
+		return diskspace.StatDiskByName(name)
+	}
+}
+
+// checkedDisks are the disks of a check that passed the filters of statDisks.
+// names holds the name of every disk in disks, which differs from its Name for remote disks, configs its config merged
+// with the configs of the paths folded into it and extraTargets the targets of those paths besides its own.
+// failed holds the names of the disks that couldn't be stat'ed and errors their errors.
+type checkedDisks struct {
+	disks        []diskspace.DiskState
+	names        []string
+	configs      []DiskConfig
+	extraTargets [][]string
+	failed       []string
+	errors       []error
+}
+
+// statDisks stats the disks diskNames, skipping the ones of ExcludeFSTypes or below MinSize and collapsing the ones
+// on the same filesystem with Dedupe. Check and NagiosCheck share it so that they look at the same disks.
+func (m *Monitor) statDisks(ctx context.Context, diskNames []string) checkedDisks {
+	var checked checkedDisks
+	filesystems := make(map[string]int)
+	for _, diskName := range diskNames {
+		_, statSpan := startSpan(ctx, "stat", attribute.String("disk.path", diskName))
+		done := m.pending.start("stat " + diskName)
+		disk, err := m.stat(diskName)
+		done()
+		if err == nil {
+			statSpan.SetAttributes(diskAttrs(disk)...)
+		}
+		endSpan(statSpan, err)
+		if err != nil {
+			slog.Warn("Couldn't stat disk, skipping it", "disk", diskName, "error", err)
+			checked.failed = append(checked.failed, diskName)
+			checked.errors = append(checked.errors, err)
+			continue
+		}
+		if disk.Host == "" {
+			disk.Host = m.Hostname
+		}
+		if m.ExcludeFSTypes[disk.FSType] {
+			slog.Debug("Skipping excluded filesystem type", "host", disk.Host, "path", disk.Name, "fstype", disk.FSType)
+			continue
+		}
+		if disk.All < m.MinSize {
+			slog.Debug("Skipping filesystem below minimum size", "host", disk.Host, "path", disk.Name, "total", diskspace.FormatBytes(disk.All))
+			continue
+		}
+		if m.Dedupe && disk.Device != 0 && !disk.Directory {
+			filesystem := disk.Host + ":" + strconv.FormatUint(disk.Device, 10)
+			if i, ok := filesystems[filesystem]; ok {
+				checked.disks[i].Aliases = append(checked.disks[i].Aliases, disk.Name)
+				aliasConfig := m.Disks[diskName]
+				if aliasConfig == checked.configs[i] {
+					slog.Debug("Skipping path on an already checked filesystem", "host", disk.Host, "path", disk.Name, "reported_as", checked.disks[i].Name)
+					continue
+				}
+				checked.extraTargets[i] = m.foldConfig(&checked.configs[i], aliasConfig, checked.extraTargets[i], disk)
+				logRoutine("Folded path into another on the same filesystem", "host", disk.Host, "path", disk.Name, "into", checked.disks[i].Name, "threshold", checked.configs[i].Threshold.String())
+				continue
+			}
+			filesystems[filesystem] = len(checked.disks)
+		}
+		checked.disks = append(checked.disks, disk)
+		checked.names = append(checked.names, diskName)
+		checked.configs = append(checked.configs, m.Disks[diskName])
+		checked.extraTargets = append(checked.extraTargets, nil)
+	}
+	return checked
+}
+
+// foldConfig merges the config of a path folded into config, both on the filesystem of disk, and returns targets with
+// the target of the path added unless config already reports to it. The stricter threshold for disk wins, that is the
+// one that alerts or escalates where the other doesn't, or the higher one of the same kind.
+func (m *Monitor) foldConfig(config *DiskConfig, folded DiskConfig, targets []string, disk diskspace.DiskState) []string {
+	rank := func(threshold diskspace.Threshold) int {
+		switch {
+		case !threshold.Breached(disk):
+			return 0
+		case !threshold.CriticalBreached(disk, m.Critical):
+			return 1
+		default:
+			return 2
+		}
+	}
+	current, candidate := rank(config.Threshold), rank(folded.Threshold)
+	if candidate > current || (candidate == current && folded.Threshold.Absolute == config.Threshold.Absolute && folded.Threshold.Value > config.Threshold.Value) {
+		config.Threshold = folded.Threshold
+	}
+	if config.Label == "" {
+		config.Label = folded.Label
+	}
+	target := folded.Target
+	if target == "" {
+		target = m.DefaultTarget
+	}
+	own := config.Target
+	if own == "" {
+		own = m.DefaultTarget
+	}
+	if target == own || slices.Contains(targets, target) {
+		return targets
+	}
+	return append(targets, target)
+}
+
+// sortedDiskNames returns the names of the configured disks in order
+func (m *Monitor) sortedDiskNames() []string {
+	diskNames := make([]string, 0, len(m.Disks))
+	for diskName := range m.Disks {
+		diskNames = append(diskNames, diskName)
+	}
+	sort.Strings(diskNames)
+	return diskNames
+}
+
+// List stats every disk and prints a table of their usage to out, regardless of thresholds.
+// It returns the errors of the disks that couldn't be stat'ed.
+func (m *Monitor) List(out io.Writer) []error {
+	var errs []error
+	var disks []diskspace.DiskState
+	var severities []string
+	for _, diskName := range m.sortedDiskNames() {
+		disk, err := m.stat(diskName)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if disk.Host == "" {
+			disk.Host = m.Hostname
+		}
+		disks = append(disks, disk)
+		severities = append(severities, alertSeverity(Alert{Disk: disk, Threshold: m.Disks[diskName].Threshold}, m.Critical))
+	}
+	printDiskTable(out, disks, severities, m.Color)
+	return errs
+}
+
+// freePercentageHeader is the header of the last column of printDiskTable
+const freePercentageHeader = "FREE %"
+
+// printDiskTable prints disks as a table with the HOST and PATH columns left and the numeric ones right aligned.
+// With color the FREE % column is colored by the severity of its disk.
+func printDiskTable(out io.Writer, disks []diskspace.DiskState, severities []string, color bool) {
+	// tabwriter aligns every column the same way, so the text columns are padded up front as a single cell.
+	// The FREE % column is padded by hand and left unterminated, so that its escape codes don't shift the others.
+	hostWidth, pathWidth := len("HOST"), len("PATH")
+	for _, disk := range disks {
+		hostWidth = max(hostWidth, utf8.RuneCountInString(disk.Host))
+		pathWidth = max(pathWidth, utf8.RuneCountInString(disk.Name))
+	}
+	table := tabwriter.NewWriter(out, 0, 0, 0, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(table, "%-*s  %-*s\t  TOTAL\t  USED\t  FREE\t  %s\n", hostWidth, "HOST", pathWidth, "PATH", freePercentageHeader)
+	for i, disk := range disks {
+		freePercentage := fmt.Sprintf("%*s", len(freePercentageHeader), fmt.Sprintf("%d%%", disk.FreePercentage))
+		fmt.Fprintf(table, "%-*s  %-*s\t  %s\t  %s\t  %s\t  %s\n", hostWidth, disk.Host, pathWidth, disk.Name,
+			diskspace.FormatBytes(disk.All), diskspace.FormatBytes(disk.Used), diskspace.FormatBytes(disk.Free), colorize(color, severities[i], freePercentage))
+	}
+	table.Flush()
+}
+
+// SelfTest stats every disk and verifies the notifier if it is a Verifier, printing one line per check to out.
+// No report is sent. It reports whether all checks passed.
+func (m *Monitor) SelfTest(ctx context.Context, out io.Writer) bool {
+	diskNames := m.sortedDiskNames()
+
+	failed := 0
+	for _, diskName := range diskNames {
+		disk, err := m.stat(diskName)
+		if err != nil {
+			fmt.Fprintf(out, "FAIL disk %s: %v\n", diskName, err)
+			failed++
+			continue
+		}
+		fmt.Fprintf(out, "OK   disk %s: %s of %s free (%d%%), threshold %s\n", diskName, diskspace.FormatBytes(disk.Free), diskspace.FormatBytes(disk.All), disk.FreePercentage, m.Disks[diskName].Threshold)
+	}
+	checks := len(diskNames)
+	if verifier, ok := m.Notifier.(Verifier); ok {
+		checks++
+		if status, err := verifier.Verify(ctx); err != nil {
+			fmt.Fprintf(out, "FAIL notifier: %v\n", err)
+			failed++
+		} else {
+			fmt.Fprintf(out, "OK   notifier: %s\n", status)
+		}
+	}
+	fmt.Fprintf(out, "%d of %d checks passed\n", checks-failed, checks)
+	return failed == 0
+}
+
+// diskReport is the JSON object printed for every checked disk with -output json
+type diskReport struct {
+	diskspace.DiskState
+	Threshold diskspace.Threshold `json:"threshold"`
+	Breached  bool                `json:"breached"`
+}
+
+// printDiskReport prints the state of the disk of alert along with its threshold as one line of JSON
+func printDiskReport(alert Alert) {
+	report, err := json.Marshal(diskReport{DiskState: alert.Disk, Threshold: alert.Threshold, Breached: alert.Threshold.Breached(alert.Disk)})
+	if err != nil {
+		slog.Error("Couldn't encode disk state", "path", alert.Disk.Name, "error", err)
+		return
+	}
+	fmt.Println(string(report))
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/danthelion/diskspace2slack/diskspace"
+)
+
+// failingNotifier fails every alert, counting the calls
+type failingNotifier struct {
+	calls atomic.Int32
+}
+
+func (n *failingNotifier) Notify(ctx context.Context, alert Alert) error {
+	n.calls.Add(1)
+	return errors.New("notifier down")
+}
+
+// failingSummaryNotifier fails every summary
+type failingSummaryNotifier struct {
+	failingNotifier
+}
+
+func (n *failingSummaryNotifier) NotifySummary(ctx context.Context, target string, summary RunSummary) error {
+	n.calls.Add(1)
+	return errors.New("summary rejected")
+}
+
+// testDisk is a disk with total and free bytes and no inode table, its percentages set like StatDisk does
+func testDisk(name string, total uint64, free uint64) diskspace.DiskState {
+	disk := diskspace.DiskState{Name: name, All: total, Free: free, FreeTotal: free, Used: total - free, InodesFreePercentage: 100}
+	if total > 0 {
+		disk.FreePercentage = free * 100 / total
+		disk.UsedPercentage = 100 - disk.FreePercentage
+	}
+	return disk
+}
+
+// lowDiskMonitor returns a Monitor of count disks with 1% free below a 10% threshold, all alerting on notifier
+func lowDiskMonitor(count int, notifier Notifier) *Monitor {
+	disks := make(map[string]DiskConfig)
+	for i := 0; i < count; i++ {
+		disks[fmt.Sprintf("/disk%d", i)] = DiskConfig{Threshold: diskspace.Threshold{Value: 10}}
+	}
+	return &Monitor{
+		Disks:         disks,
+		DefaultTarget: "#ops",
+		Hostname:      "test",
+		Notifier:      notifier,
+		Stat: func(name string) (diskspace.DiskState, error) {
+			return testDisk(name, 100, 1), nil
+		},
+	}
+}
+
+// TestCheckCollectsNotifierErrors runs many failing reports at once, which used to send on the closed error channel
+// under -race
+func TestCheckCollectsNotifierErrors(t *testing.T) {
+	for _, maxConcurrency := range []int{0, 1, 3} {
+		t.Run(fmt.Sprintf("max-concurrency %d", maxConcurrency), func(t *testing.T) {
+			notifier := &failingNotifier{}
+			monitor := lowDiskMonitor(50, notifier)
+			monitor.MaxConcurrency = maxConcurrency
+			for i := 0; i < 5; i++ {
+				monitor.alerted = nil
+				result := monitor.Check(context.Background())
+				if result.Reports != 50 || len(result.Errors) != 50 {
+					t.Fatalf("Check() = %d reports, %d errors, want 50 of each", result.Reports, len(result.Errors))
+				}
+			}
+			if calls := notifier.calls.Load(); calls != 250 {
+				t.Errorf("notifier called %d times, want 250", calls)
+			}
+		})
+	}
+}
+
+func TestCheckStopOnNotifyError(t *testing.T) {
+	notifier := &failingNotifier{}
+	monitor := lowDiskMonitor(20, notifier)
+	monitor.MaxConcurrency = 1
+	monitor.StopOnNotifyError = true
+	result := monitor.Check(context.Background())
+	if len(result.Errors) != 20 {
+		t.Fatalf("Check() = %d errors, want 20 failed or skipped reports", len(result.Errors))
+	}
+	if calls := notifier.calls.Load(); calls != 1 {
+		t.Errorf("notifier called %d times, want 1", calls)
+	}
+}
+
+// TestCheckFailedSummaryWithoutBreach fails the summary of a check without breached disks, which used to block on the
+// error channel that was only buffered for the alerts
+func TestCheckFailedSummaryWithoutBreach(t *testing.T) {
+	notifier := &failingSummaryNotifier{}
+	monitor := lowDiskMonitor(3, notifier)
+	monitor.SummaryOnly = true
+	monitor.Stat = func(name string) (diskspace.DiskState, error) {
+		return testDisk(name, 100, 50), nil
+	}
+	done := make(chan CheckResult)
+	go func() { done <- monitor.Check(context.Background()) }()
+	select {
+	case result := <-done:
+		if result.Breached != 0 || result.Reports != 1 || len(result.Errors) != 1 {
+			t.Errorf("Check() = %d breached, %d reports, %d errors, want 0, 1 and 1", result.Breached, result.Reports, len(result.Errors))
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Check() didn't return after the summary failed")
+	}
+}
+
+// recordingNotifier records every alert it is sent
+type recordingNotifier struct {
+	mu     sync.Mutex
+	alerts []Alert
+}
+
+func (n *recordingNotifier) Notify(ctx context.Context, alert Alert) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.alerts = append(n.alerts, alert)
+	return nil
+}
+
+func TestCheckDedupeKeepsFoldedConfig(t *testing.T) {
+	notifier := &recordingNotifier{}
+	monitor := &Monitor{
+		Disks: map[string]DiskConfig{
+			"/":     {Threshold: diskspace.Threshold{Value: 10}},
+			"/home": {Threshold: diskspace.Threshold{Value: 30}, Target: "#home", Label: "Home"},
+		},
+		DefaultTarget: "#ops",
+		Hostname:      "test",
+		Dedupe:        true,
+		Notifier:      notifier,
+		Stat: func(name string) (diskspace.DiskState, error) {
+			disk := testDisk(name, 100, 20)
+			disk.Device = 1
+			return disk, nil
+		},
+	}
+	result := monitor.Check(context.Background())
+	if result.Breached != 1 || len(result.Errors) != 0 {
+		t.Fatalf("Check() = %d breached, %d errors, want 1 and 0", result.Breached, len(result.Errors))
+	}
+	targets := make(map[string]bool)
+	for _, alert := range notifier.alerts {
+		targets[alert.Target] = true
+		if alert.Disk.Name != "/" || alert.Threshold.Value != 30 || alert.Disk.DisplayName != "Home" {
+			t.Errorf("alert for %s with threshold %s and label %q, want / with 30 and Home", alert.Disk.Name, alert.Threshold, alert.Disk.DisplayName)
+		}
+	}
+	if len(notifier.alerts) != 2 || !targets["#ops"] || !targets["#home"] {
+		t.Errorf("alerted %d times on %v, want #ops and #home", len(notifier.alerts), targets)
+	}
+
+	// Identical configs collapse into a single alert
+	notifier.alerts = nil
+	monitor.alerted = nil
+	monitor.Disks["/"] = monitor.Disks["/home"]
+	monitor.Check(context.Background())
+	if len(notifier.alerts) != 1 || notifier.alerts[0].Disk.Name != "/" {
+		t.Errorf("alerted %d times, want once for /", len(notifier.alerts))
+	}
+}
+
+// TestCheckDedupeCooldown sends the alert of a disk to the targets of its folded paths through a cooldown, which used
+// to let only the first of them through
+func TestCheckDedupeCooldown(t *testing.T) {
+	notifier := &recordingNotifier{}
+	monitor := &Monitor{
+		Disks: map[string]DiskConfig{
+			"/":     {Threshold: diskspace.Threshold{Value: 30}},
+			"/home": {Threshold: diskspace.Threshold{Value: 30}, Target: "#home"},
+		},
+		DefaultTarget: "#ops",
+		Hostname:      "test",
+		Dedupe:        true,
+		Notifier: &MultiNotifier{
+			Notifiers: []NamedNotifier{{Name: "recording", Notifier: notifier}},
+			Cooldown:  &Cooldown{Duration: time.Hour},
+		},
+		Stat: func(name string) (diskspace.DiskState, error) {
+			disk := testDisk(name, 100, 20)
+			disk.Device = 1
+			return disk, nil
+		},
+	}
+	for _, batch := range []bool{false, true} {
+		notifier.alerts = nil
+		monitor.alerted = nil
+		monitor.Batch = batch
+		monitor.Notifier.(*MultiNotifier).Cooldown = &Cooldown{Duration: time.Hour}
+		monitor.Check(context.Background())
+		targets := make(map[string]bool)
+		for _, alert := range notifier.alerts {
+			targets[alert.Target] = true
+		}
+		if len(notifier.alerts) != 2 || !targets["#ops"] || !targets["#home"] {
+			t.Errorf("batch %v: alerted %d times on %v, want #ops and #home", batch, len(notifier.alerts), targets)
+		}
+	}
+}
+
+func TestCheckStatError(t *testing.T) {
+	notifier := &recordingNotifier{}
+	monitor := lowDiskMonitor(2, notifier)
+	monitor.Stat = func(name string) (diskspace.DiskState, error) {
+		if name == "/disk0" {
+			return diskspace.DiskState{}, errors.New("Couldn't stat path " + name)
+		}
+		return testDisk(name, 100, 1), nil
+	}
+	result := monitor.Check(context.Background())
+	if result.Breached != 1 || len(result.StatErrors) != 1 || len(result.Errors) != 0 {
+		t.Fatalf("Check() = %d breached, %d stat errors, %d errors, want 1, 1 and 0", result.Breached, len(result.StatErrors), len(result.Errors))
+	}
+	if len(notifier.alerts) != 1 || notifier.alerts[0].Disk.Name != "/disk1" {
+		t.Errorf("alerted %d times, want once for /disk1", len(notifier.alerts))
+	}
+}
+
+// TestCheckRemindEscalation alerts again within the remind window once a disk turns critical, but not while it stays
+// at the severity it alerted with
+func TestCheckRemindEscalation(t *testing.T) {
+	notifier := &recordingNotifier{}
+	free := uint64(15)
+	monitor := &Monitor{
+		Disks:         map[string]DiskConfig{"/": {Threshold: diskspace.Threshold{Value: 20}}},
+		DefaultTarget: "#ops",
+		Hostname:      "test",
+		Critical:      5,
+		RemindAfter:   time.Hour,
+		Notifier:      notifier,
+		Stat: func(name string) (diskspace.DiskState, error) {
+			return testDisk(name, 100, free), nil
+		},
+	}
+	for _, step := range []struct {
+		free    uint64
+		alerted bool
+	}{
+		{15, true},  // warning
+		{10, false}, // still warning
+		{3, true},   // critical
+		{2, false},  // still critical
+		{10, false}, // back to warning
+	} {
+		free = step.free
+		notifier.alerts = nil
+		monitor.Check(context.Background())
+		if alerted := len(notifier.alerts) > 0; alerted != step.alerted {
+			t.Errorf("%d%% free: alerted = %v, want %v", step.free, alerted, step.alerted)
+		}
+	}
+}
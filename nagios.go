@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/danthelion/diskspace2slack/diskspace"
+)
+
+// Nagios plugin exit codes, also used by Icinga and compatible systems
+const (
+	NagiosOK       = 0
+	NagiosWarning  = 1
+	NagiosCritical = 2
+	NagiosUnknown  = 3
+)
+
+// nagiosStatusNames are the status labels of the plugin output by exit code
+var nagiosStatusNames = map[int]string{
+	NagiosOK:       "OK",
+	NagiosWarning:  "WARNING",
+	NagiosCritical: "CRITICAL",
+	NagiosUnknown:  "UNKNOWN",
+}
+
+// nagiosRank orders the statuses from best to worst, a disk that couldn't be checked is worse than a warning
+var nagiosRank = map[int]int{
+	NagiosOK:       0,
+	NagiosWarning:  1,
+	NagiosUnknown:  2,
+	NagiosCritical: 3,
+}
+
+// NagiosCheck stats every disk and prints a single Nagios plugin line with performance data to out, e.g.
+//
+//	DISK CRITICAL - / free 3%, /var free 40% | free_pct_/=3;10;5 free_pct_/var=40;10;5
+//
+// Disks are filtered and deduped like Check does, disks that couldn't be stat'ed are listed as unknown at the end.
+// No report is sent. It returns the exit code of the worst status across all disks.
+func (m *Monitor) NagiosCheck(out io.Writer) int {
+	status := NagiosOK
+	var summaries, perfData []string
+	checked := m.statDisks(context.Background(), m.sortedDiskNames())
+	for i, disk := range checked.disks {
+		alert := Alert{Disk: disk, Threshold: checked.configs[i].Threshold}
+		alert.ReadOnly = disk.ReadOnly && !m.ExpectReadOnly[normalizePath(checked.names[i])]
+		switch alertSeverity(alert, m.Critical) {
+		case "danger":
+			status = worseNagiosStatus(status, NagiosCritical)
+		case "warning":
+			status = worseNagiosStatus(status, NagiosWarning)
+		}
+		summaries = append(summaries, nagiosSummary(alert))
+		perfData = append(perfData, nagiosPerfData(alert, m.Critical))
+	}
+	for _, diskName := range checked.failed {
+		status = worseNagiosStatus(status, NagiosUnknown)
+		summaries = append(summaries, diskName+" unknown")
+	}
+	line := fmt.Sprintf("DISK %s - %s", nagiosStatusNames[status], strings.Join(summaries, ", "))
+	if len(perfData) > 0 {
+		line += " | " + strings.Join(perfData, " ")
+	}
+	fmt.Fprintln(out, line)
+	return status
+}
+
+// worseNagiosStatus returns the worse of two statuses
+func worseNagiosStatus(a int, b int) int {
+	if nagiosRank[b] > nagiosRank[a] {
+		return b
+	}
+	return a
+}
+
+// nagiosSummary describes the disk of alert for the plugin output, e.g. `/ free 3%`
+func nagiosSummary(alert Alert) string {
+	disk := alert.Disk
+	summary := fmt.Sprintf("%s free %d%%", disk.Name, disk.FreePercentage)
+	if disk.Directory {
+		summary = fmt.Sprintf("%s size %s", disk.Name, diskspace.FormatBytes(disk.DirSize))
+	}
+	if alert.ReadOnly {
+		summary += " read-only"
+	}
+	return summary
+}
+
+// nagiosPerfData returns the performance data of the disk of alert, the free percentage along with the warning and
+// critical levels, which are left empty for absolute thresholds. Directories report their size in bytes instead.
+func nagiosPerfData(alert Alert, critical uint64) string {
+	disk, threshold := alert.Disk, alert.Threshold
+	if disk.Directory {
+		return fmt.Sprintf("%s=%dB;%d;", nagiosLabel("dir_size_"+disk.Name), disk.DirSize, threshold.Value)
+	}
+	warningLevel, criticalLevel := "", ""
+	if !threshold.Absolute {
+		warningLevel = fmt.Sprint(threshold.Value)
+		criticalLevel = fmt.Sprint(critical)
+		if threshold.HasCritical {
+			criticalLevel = fmt.Sprint(threshold.Critical)
+		}
+	}
+	return fmt.Sprintf("%s=%d;%s;%s", nagiosLabel("free_pct_"+disk.Name), disk.FreePercentage, warningLevel, criticalLevel)
+}
+
+// nagiosLabel quotes a performance data label if it contains spaces or characters with a meaning in perfdata
+func nagiosLabel(label string) string {
+	if strings.ContainsAny(label, " ='") {
+		return "'" + strings.ReplaceAll(label, "'", "''") + "'"
+	}
+	return label
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/danthelion/diskspace2slack/diskspace"
+)
+
+// TestNagiosCheckFilters skips the same disks as Check, which it used to report regardless of the filters
+func TestNagiosCheckFilters(t *testing.T) {
+	monitor := &Monitor{
+		Disks: map[string]DiskConfig{
+			"/":          {Threshold: diskspace.Threshold{Value: 10}},
+			"/home":      {Threshold: diskspace.Threshold{Value: 10}},
+			"/snap/core": {Threshold: diskspace.Threshold{Value: 10}},
+			"/boot/efi":  {Threshold: diskspace.Threshold{Value: 10}},
+		},
+		Hostname:       "test",
+		Dedupe:         true,
+		ExcludeFSTypes: map[string]bool{"squashfs": true},
+		MinSize:        diskspace.GIGABYTE,
+		Notifier:       &recordingNotifier{},
+		Stat: func(name string) (diskspace.DiskState, error) {
+			switch name {
+			case "/snap/core":
+				disk := testDisk(name, 2*diskspace.GIGABYTE, 0)
+				disk.FSType = "squashfs"
+				return disk, nil
+			case "/boot/efi":
+				return testDisk(name, diskspace.MEGABYTE, 0), nil
+			}
+			disk := testDisk(name, 100*diskspace.GIGABYTE, 50*diskspace.GIGABYTE)
+			disk.Device = 1
+			return disk, nil
+		},
+	}
+	if result := monitor.Check(context.Background()); result.Breached != 0 {
+		t.Fatalf("Check() = %d breached, want 0", result.Breached)
+	}
+	var out bytes.Buffer
+	if status := monitor.NagiosCheck(&out); status != NagiosOK {
+		t.Errorf("NagiosCheck() = %d, want %d: %s", status, NagiosOK, out.String())
+	}
+	if line := out.String(); !strings.HasPrefix(line, "DISK OK - / free 50% |") {
+		t.Errorf("NagiosCheck() printed %q, want / alone", line)
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/danthelion/diskspace2slack/diskspace"
+)
+
+// defaultHTTPTimeout bounds the requests of the webhook and email notifiers without a Timeout of their own
+const defaultHTTPTimeout = 10 * time.Second
+
+// timeoutClient returns a client giving up on requests after timeout, or defaultHTTPTimeout if it is zero
+func timeoutClient(timeout time.Duration) *http.Client {
+	if timeout <= 0 {
+		timeout = defaultHTTPTimeout
+	}
+	return &http.Client{Timeout: timeout}
+}
+
+// routineLevel is the level of routine log lines like checked disks and sent reports, debug with -quiet
+var routineLevel = slog.LevelInfo
+
+// logRoutine logs a routine line at routineLevel
+func logRoutine(msg string, args ...any) {
+	slog.Log(context.Background(), routineLevel, msg, args...)
+}
+
+// Alert is a single disk report handed to a Notifier
+type Alert struct {
+	Disk      diskspace.DiskState
+	Threshold diskspace.Threshold
+	// Target is the person or channel to notify, backends without targets ignore it
+	Target string
+	// Recovered marks a disk that is back above its threshold after alerting
+	Recovered bool
+	// Growth is the observed decline of free space, zero unless -growth-alert is set
+	Growth diskspace.Growth
+	// ReadOnly marks a disk that is mounted read-only without being expected to, which alerts regardless of its threshold
+	ReadOnly bool
+	// OK marks a disk within its threshold, which is only reported with -report-always
+	OK bool
+	// Critical is the free percentage below which the alert is critical if its threshold has no critical level,
+	// it selects the label of Message
+	Critical uint64
+	// Run describes the check that raised the alert for the footer, nil unless -verbose-footer is set
+	Run *diskspace.RunInfo
+}
+
+// Problem describes why alert was raised, for titles and summaries
+func (alert Alert) Problem() string {
+	if alert.ReadOnly {
+		return "Read-only mount"
+	}
+	if alert.OK {
+		return "Disk space OK"
+	}
+	if alert.Disk.Directory {
+		return "Large directory"
+	}
+	return "Low disk space"
+}
+
+// Message renders the alert as plain text, using DiskRecoveryAsString for recovered disks
+func (alert Alert) Message() string {
+	if alert.Recovered {
+		return diskspace.DiskRecoveryAsString(alert.Disk, alert.Disk.Name, alert.Threshold, alert.Disk.Host, alert.Run)
+	}
+	return diskspace.DiskUsageStatsAsString(alert.Disk, alert.Disk.Name, alert.Threshold, alert.Disk.Host, alert.Growth, Severity(alert, alert.Critical), alert.Run)
+}
+
+// Severity classifies alert for every notifier: danger for unexpected read-only mounts and below the critical level
+// of its threshold, or the critical percentage if it has none, good for OK alerts and warning otherwise.
+// The names are the Slack attachment colors.
+func Severity(alert Alert, critical uint64) string {
+	if alert.OK {
+		return "good"
+	}
+	if alert.ReadOnly || alert.Threshold.CriticalBreached(alert.Disk, critical) {
+		return "danger"
+	}
+	return "warning"
+}
+
+// severityRank orders the severities of Severity from best to worst
+var severityRank = map[string]int{"good": 0, "warning": 1, "danger": 2}
+
+// LogAttrs returns the fields identifying alert in structured log lines
+func (alert Alert) LogAttrs() []any {
+	return []any{"host", alert.Disk.Host, "path", alert.Disk.Name, "free_pct", alert.Disk.FreePercentage, "threshold", alert.Threshold.String()}
+}
+
+// Notifier delivers alerts to a backend such as Slack
+type Notifier interface {
+	Notify(ctx context.Context, alert Alert) error
+}
+
+// BatchNotifier is a Notifier that can deliver several alerts for the same target in a single message
+type BatchNotifier interface {
+	Notifier
+	NotifyBatch(ctx context.Context, target string, alerts []Alert) error
+}
+
+// SummaryNotifier is a Notifier that can deliver a RunSummary as a single message, used for -summary-only
+type SummaryNotifier interface {
+	Notifier
+	NotifySummary(ctx context.Context, target string, summary RunSummary) error
+}
+
+// RunSummary is the outcome of a single check for -summary-only: how many disks were checked and which of them breached
+type RunSummary struct {
+	Host     string
+	Checked  int
+	Breached []Alert
+}
+
+// Text renders the summary as a header line and a bulleted list of the breached disks, e.g.
+//
+//	*Disk summary* for `web1`: 3 of 5 disks healthy, 2 breached
+//	• `/var` 4% free
+//	• `/data` on db1: 8% free
+func (s RunSummary) Text() string {
+	var text strings.Builder
+	fmt.Fprintf(&text, "*Disk summary* for `%s`: %s", s.Host, s.Counts())
+	for _, alert := range s.Breached {
+		disk := alert.Disk
+		fmt.Fprintf(&text, "\n• `%s`", disk.Name)
+		if disk.Host != s.Host {
+			fmt.Fprintf(&text, " on %s:", disk.Host)
+		}
+		switch {
+		case alert.ReadOnly:
+			text.WriteString(" read-only")
+		case disk.Directory:
+			fmt.Fprintf(&text, " %s", diskspace.FormatBytes(disk.DirSize))
+		default:
+			fmt.Fprintf(&text, " %d%% free", disk.FreePercentage)
+		}
+	}
+	return text.String()
+}
+
+// Counts returns the number of healthy and breached disks, e.g. `3 of 5 disks healthy, 2 breached`
+func (s RunSummary) Counts() string {
+	disks := "disks"
+	if s.Checked == 1 {
+		disks = "disk"
+	}
+	counts := fmt.Sprintf("%d of %d %s healthy", s.Checked-len(s.Breached), s.Checked, disks)
+	if len(s.Breached) > 0 {
+		counts += fmt.Sprintf(", %d breached", len(s.Breached))
+	}
+	return counts
+}
+
+// Severity is the worst Severity of the breached disks, good if there are none
+func (s RunSummary) Severity(critical uint64) string {
+	severity := "good"
+	for _, alert := range s.Breached {
+		if severity = Severity(alert, critical); severity == "danger" {
+			break
+		}
+	}
+	return severity
+}
+
+// Verifier is a Notifier that can check its configuration without sending anything, used for -check
+type Verifier interface {
+	Verify(ctx context.Context) (string, error)
+}
+
+// StdoutNotifier prints alerts to Out, stdout unless it is reserved for -output json, used for -dry-run.
+// With Color the header of every alert is colored by its severity, using Critical like SlackNotifier.
+type StdoutNotifier struct {
+	Out      io.Writer
+	Color    bool
+	Critical uint64
+}
+
+// Notify prints the rendered alert
+func (n StdoutNotifier) Notify(ctx context.Context, alert Alert) error {
+	header := colorize(n.Color, alertSeverity(alert, n.Critical), fmt.Sprintf("Dry run, report not sent to %s:", alert.Target))
+	fmt.Fprintf(n.Out, "%s\n%s\n", header, alert.Message())
+	return nil
+}
+
+// NotifySummary prints the rendered summary
+func (n StdoutNotifier) NotifySummary(ctx context.Context, target string, summary RunSummary) error {
+	header := colorize(n.Color, summary.Severity(n.Critical), fmt.Sprintf("Dry run, summary not sent to %s:", target))
+	fmt.Fprintf(n.Out, "%s\n%s\n", header, summary.Text())
+	return nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/danthelion/diskspace2slack/diskspace"
+)
+
+// TestWebhookNotifiersTimeout posts to a server that never responds, which used to block the report forever
+func TestWebhookNotifiersTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	timeout := 50 * time.Millisecond
+	notifiers := map[string]Notifier{
+		"teams":     &TeamsNotifier{WebhookURL: server.URL, Timeout: timeout},
+		"discord":   &DiscordNotifier{WebhookURL: server.URL, Timeout: timeout},
+		"http":      &HTTPNotifier{URL: server.URL, Timeout: timeout},
+		"pagerduty": &PagerDutyNotifier{RoutingKey: "key", Critical: 5, URL: server.URL, Timeout: timeout},
+	}
+	// Critical, so that PagerDuty triggers an incident
+	alert := Alert{Disk: testDisk("/", 100, 1), Threshold: diskspace.Threshold{Value: 10}, Target: "#ops"}
+	for name, notifier := range notifiers {
+		t.Run(name, func(t *testing.T) {
+			started := time.Now()
+			if err := notifier.Notify(context.Background(), alert); err == nil {
+				t.Fatal("Notify() succeeded, want a timeout")
+			}
+			if elapsed := time.Since(started); elapsed > 5*time.Second {
+				t.Errorf("Notify() returned after %s, want about %s", elapsed, timeout)
+			}
+		})
+	}
+}
+
+// TestEmailNotifierTimeout connects to a server that never greets, which used to block the report without a ctx deadline
+func TestEmailNotifierTimeout(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	notifier := &EmailNotifier{Host: host, Port: port, From: "disk@example.com", To: []string{"ops@example.com"}, Timeout: 50 * time.Millisecond}
+	started := time.Now()
+	if err := notifier.Notify(context.Background(), Alert{Disk: testDisk("/", 100, 1)}); err == nil {
+		t.Fatal("Notify() succeeded, want a timeout")
+	}
+	if elapsed := time.Since(started); elapsed > 5*time.Second {
+		t.Errorf("Notify() returned after %s, want about 50ms", elapsed)
+	}
+}
+
+func TestEmailSubject(t *testing.T) {
+	threshold := diskspace.Threshold{Value: 20}
+	dir := testDisk("/var/log", 0, 0)
+	dir.Directory = true
+	dir.DirSize = 10 * diskspace.GIGABYTE
+	tests := []struct {
+		alert Alert
+		want  string
+	}{
+		{Alert{Disk: testDisk("/", 100, 15), Threshold: threshold, Critical: 5}, "[WARNING] Low disk space on :/"},
+		{Alert{Disk: testDisk("/", 100, 3), Threshold: threshold, Critical: 5}, "[CRITICAL] Low disk space on :/"},
+		{Alert{Disk: testDisk("/", 100, 50), Threshold: threshold, ReadOnly: true}, "[CRITICAL] Read-only mount on :/"},
+		{Alert{Disk: dir, Threshold: diskspace.Threshold{Value: diskspace.GIGABYTE, Absolute: true}}, "[WARNING] Large directory on :/var/log"},
+		{Alert{Disk: testDisk("/", 100, 50), Threshold: threshold, OK: true}, "[OK] Disk space OK on :/"},
+		{Alert{Disk: testDisk("/", 100, 50), Threshold: threshold, Recovered: true}, "[RECOVERED] Disk space back on :/"},
+	}
+	for _, test := range tests {
+		if got := emailSubject(test.alert); got != test.want {
+			t.Errorf("emailSubject() = %q, want %q", got, test.want)
+		}
+	}
+}
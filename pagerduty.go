@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// pagerDutyEventsURL is the PagerDuty Events API v2 endpoint
+const pagerDutyEventsURL = "https://events.pagerduty.com/v2/enqueue"
+
+// PagerDutyNotifier triggers a PagerDuty incident for disks below the critical level of their threshold,
+// or Critical percent if it has none, and resolves it once the disk recovers. Other alerts are left to other notifiers.
+// Events that take longer than Timeout, or defaultHTTPTimeout if it is zero, to be accepted are aborted.
+type PagerDutyNotifier struct {
+	RoutingKey string
+	Critical   uint64
+	Timeout    time.Duration
+	// URL overrides pagerDutyEventsURL when set
+	URL string
+}
+
+// pagerDutyEvent is the JSON payload of the Events API v2
+type pagerDutyEvent struct {
+	RoutingKey  string            `json:"routing_key"`
+	EventAction string            `json:"event_action"`
+	DedupKey    string            `json:"dedup_key"`
+	Payload     *pagerDutyPayload `json:"payload,omitempty"`
+}
+
+// pagerDutyPayload describes a triggered incident
+type pagerDutyPayload struct {
+	Summary       string     `json:"summary"`
+	Source        string     `json:"source"`
+	Severity      string     `json:"severity"`
+	CustomDetails diskReport `json:"custom_details"`
+}
+
+// Notify triggers an incident for a critical alert or resolves it for a recovered one, other alerts are ignored.
+// The dedup key is host:path, so repeated triggers for the same disk update a single incident.
+func (n *PagerDutyNotifier) Notify(ctx context.Context, alert Alert) error {
+	event := pagerDutyEvent{RoutingKey: n.RoutingKey, DedupKey: alert.Disk.Host + ":" + alert.Disk.Name}
+	switch {
+	case alert.Recovered:
+		event.EventAction = "resolve"
+	case Severity(alert, n.Critical) == "danger":
+		event.EventAction = "trigger"
+		event.Payload = &pagerDutyPayload{
+			Summary:       fmt.Sprintf("%s on %s:%s, %d%% free", alert.Problem(), alert.Disk.Host, alert.Disk.Name, alert.Disk.FreePercentage),
+			Source:        alert.Disk.Host,
+			Severity:      "critical",
+			CustomDetails: diskReport{DiskState: alert.Disk, Threshold: alert.Threshold, Breached: true},
+		}
+	default:
+		slog.Debug("Not paging for disk above critical threshold", alert.LogAttrs()...)
+		return nil
+	}
+	if err := n.send(ctx, event); err != nil {
+		return err
+	}
+	logRoutine("PagerDuty event sent", append(alert.LogAttrs(), "action", event.EventAction)...)
+	return nil
+}
+
+// send posts event to the Events API
+func (n *PagerDutyNotifier) send(ctx context.Context, event pagerDutyEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	url := n.URL
+	if url == "" {
+		url = pagerDutyEventsURL
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := timeoutClient(n.Timeout).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("PagerDuty returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
@@ -0,0 +1,389 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// SlackNotifier posts alerts to Slack as colored attachments.
+// When WebhookURL is set alerts are posted to the Incoming Webhook, otherwise Token is used.
+// Disks below the critical level of their threshold, or Critical percent, are reported as danger instead of warning.
+// Posts that take longer than Timeout are aborted, a zero Timeout waits forever.
+// Rate limited, 5xx and network failures are tried up to Attempts times.
+// Username, IconEmoji and IconURL override the bot identity of API token posts when set.
+// Mention, e.g. <!here> or <@U12345>, is posted along with critical alerts so they ping people.
+// With Thread, API token posts are replies to a daily "Disk report" message per target.
+// HTTPClient, e.g. one using a proxy, replaces http.DefaultClient when set.
+type SlackNotifier struct {
+	Token      string
+	WebhookURL string
+	Critical   uint64
+	Timeout    time.Duration
+	Attempts   int
+	Username   string
+	IconEmoji  string
+	IconURL    string
+	Mention    string
+	Thread     bool
+	HTTPClient *http.Client
+
+	// threads holds the thread roots of the current day by target and day, guarded by threadsMu
+	threadsMu sync.Mutex
+	threads   map[string]threadRoot
+}
+
+// threadRoot is the parent message that alerts are posted under with Thread
+type threadRoot struct {
+	day       string
+	channel   string
+	timestamp string
+}
+
+// retryBaseDelay is the wait before the first retry, doubled for each further one
+const retryBaseDelay = time.Second
+
+// webhookMessage is the JSON payload accepted by Slack Incoming Webhooks
+type webhookMessage struct {
+	Text        string             `json:"text,omitempty"`
+	Attachments []slack.Attachment `json:"attachments"`
+}
+
+// PostWebhook posts text and attachments to a Slack Incoming Webhook URL
+func PostWebhook(ctx context.Context, url string, text string, attachments []slack.Attachment) error {
+	return postWebhook(ctx, http.DefaultClient, url, text, attachments)
+}
+
+// postWebhook is PostWebhook using client
+func postWebhook(ctx context.Context, client *http.Client, url string, text string, attachments []slack.Attachment) error {
+	payload, err := json.Marshal(webhookMessage{Text: text, Attachments: attachments})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		webhookErr := &WebhookError{StatusCode: resp.StatusCode, Status: resp.Status, Body: strings.TrimSpace(string(body))}
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+			webhookErr.RetryAfter = time.Duration(seconds) * time.Second
+		}
+		return webhookErr
+	}
+	return nil
+}
+
+// WebhookError is returned by PostWebhook when Slack doesn't accept the message
+type WebhookError struct {
+	StatusCode int
+	Status     string
+	Body       string
+	// RetryAfter is the delay Slack asked for when rate limiting
+	RetryAfter time.Duration
+}
+
+func (e *WebhookError) Error() string {
+	return fmt.Sprintf("Webhook returned %s: %s", e.Status, e.Body)
+}
+
+// retryable reports whether a failed post is worth retrying, i.e. it was rate limited, hit a 5xx or a network error,
+// along with the delay Slack asked for, if any. Errors like invalid_auth are final.
+func retryable(err error) (bool, time.Duration) {
+	var rateLimited *slack.RateLimitedError
+	if errors.As(err, &rateLimited) {
+		return true, rateLimited.RetryAfter
+	}
+	var webhookErr *WebhookError
+	if errors.As(err, &webhookErr) {
+		return webhookErr.StatusCode == http.StatusTooManyRequests || webhookErr.StatusCode >= 500, webhookErr.RetryAfter
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true, 0
+	}
+	// The Web API client reports 5xx responses as "slack server error: <status>"
+	return strings.Contains(strings.ToLower(err.Error()), "server error"), 0
+}
+
+// attachment renders alert as an attachment colored by severity
+func (n *SlackNotifier) attachment(alert Alert) slack.Attachment {
+	message := alert.Message()
+	attachment := slack.Attachment{
+		Color:      Severity(alert, n.Critical),
+		Fallback:   message,
+		Text:       message,
+		MarkdownIn: []string{"text"},
+	}
+	if alert.Recovered {
+		attachment.Color = "good"
+	}
+	return attachment
+}
+
+// Verify checks the API token via auth.test without posting, a webhook can't be checked without posting to it
+func (n *SlackNotifier) Verify(ctx context.Context) (string, error) {
+	if n.WebhookURL != "" {
+		return "webhook configured, not verified without posting", nil
+	}
+	if n.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, n.Timeout)
+		defer cancel()
+	}
+	auth, err := n.api().AuthTestContext(ctx)
+	if err != nil {
+		return "", fmt.Errorf("Invalid Slack token: %w", err)
+	}
+	return fmt.Sprintf("authenticated as %s in %s", auth.User, auth.Team), nil
+}
+
+// mention returns Mention if any of alerts is critical, it is passed to Slack as is so that its link formatting applies
+func (n *SlackNotifier) mention(alerts ...Alert) string {
+	for _, alert := range alerts {
+		if !alert.Recovered && Severity(alert, n.Critical) == "danger" {
+			return n.Mention
+		}
+	}
+	return ""
+}
+
+// Notify posts alert to its target using the webhook or API token
+func (n *SlackNotifier) Notify(ctx context.Context, alert Alert) error {
+	return n.post(ctx, alert.Target, n.mention(alert), []slack.Attachment{n.attachment(alert)}, alert.LogAttrs())
+}
+
+// NotifyBatch posts all alerts to target as a single message with one attachment per disk
+func (n *SlackNotifier) NotifyBatch(ctx context.Context, target string, alerts []Alert) error {
+	attachments := make([]slack.Attachment, len(alerts))
+	paths := make([]string, len(alerts))
+	for i, alert := range alerts {
+		attachments[i] = n.attachment(alert)
+		paths[i] = alert.Disk.Name
+	}
+	return n.post(ctx, target, n.mention(alerts...), attachments, []any{"paths", strings.Join(paths, " ")})
+}
+
+// NotifySummary posts summary to target as a single attachment colored by its worst disk
+func (n *SlackNotifier) NotifySummary(ctx context.Context, target string, summary RunSummary) error {
+	text := summary.Text()
+	attachment := slack.Attachment{
+		Color:      summary.Severity(n.Critical),
+		Fallback:   text,
+		Text:       text,
+		MarkdownIn: []string{"text"},
+	}
+	return n.post(ctx, target, n.mention(summary.Breached...), []slack.Attachment{attachment}, []any{"checked", summary.Checked, "breached", len(summary.Breached)})
+}
+
+// NotifyErrors posts errs, the failures of a check on host, to channel as a single danger attachment.
+// Mention isn't posted along, the errors concern whoever runs the tool rather than the disk owners.
+func (n *SlackNotifier) NotifyErrors(ctx context.Context, channel string, host string, errs []error) error {
+	lines := make([]string, len(errs))
+	for i, err := range errs {
+		lines[i] = "• " + err.Error()
+	}
+	text := fmt.Sprintf("*diskspace2slack failed on %s*\n%s", host, strings.Join(lines, "\n"))
+	attachment := slack.Attachment{
+		Color:      "danger",
+		Fallback:   text,
+		Text:       text,
+		MarkdownIn: []string{"text"},
+	}
+	return n.post(ctx, channel, "", []slack.Attachment{attachment}, []any{"errors", len(errs)})
+}
+
+// post sends text and attachments to target, retrying transient failures up to Attempts times with exponential backoff
+func (n *SlackNotifier) post(ctx context.Context, target string, text string, attachments []slack.Attachment, logAttrs []any) error {
+	delay := retryBaseDelay
+	for attempt := 1; ; attempt++ {
+		err := n.postOnce(ctx, target, text, attachments, logAttrs)
+		if err == nil {
+			return nil
+		}
+		retry, retryAfter := retryable(err)
+		if !retry {
+			return err
+		}
+		if attempt >= n.Attempts {
+			if attempt > 1 {
+				return fmt.Errorf("giving up after %d attempts: %w", attempt, err)
+			}
+			return err
+		}
+		wait := delay
+		if retryAfter > 0 {
+			wait = retryAfter
+		}
+		slog.Warn("Slack post failed, retrying", append(logAttrs, "attempt", attempt, "retry_in", wait.String(), "error", err)...)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+		delay *= 2
+	}
+}
+
+// postOnce sends text and attachments to target, giving up after Timeout
+func (n *SlackNotifier) postOnce(ctx context.Context, target string, text string, attachments []slack.Attachment, logAttrs []any) error {
+	if n.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, n.Timeout)
+		defer cancel()
+	}
+	err := n.send(ctx, target, text, attachments, logAttrs)
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("Slack didn't respond within %s: %w", n.Timeout, err)
+	}
+	return err
+}
+
+// send posts text and attachments using the webhook or API token
+func (n *SlackNotifier) send(ctx context.Context, target string, text string, attachments []slack.Attachment, logAttrs []any) error {
+	if n.WebhookURL != "" {
+		if err := postWebhook(ctx, n.httpClient(), n.WebhookURL, text, attachments); err != nil {
+			var webhookErr *WebhookError
+			if errors.As(err, &webhookErr) {
+				return explainSlackError(err, webhookHint(webhookErr.Body))
+			}
+			return err
+		}
+		logRoutine("Message sent to webhook", logAttrs...)
+		return nil
+	}
+	api := n.api()
+	options := append(n.identity(), slack.MsgOptionText(text, false), slack.MsgOptionAttachments(attachments...))
+	if n.Thread {
+		root, err := n.threadRoot(ctx, api, target)
+		if err != nil {
+			return err
+		}
+		target = root.channel
+		options = append(options, slack.MsgOptionTS(root.timestamp))
+	}
+	channelID, timestamp, err := api.PostMessageContext(ctx, target, options...)
+	if err != nil {
+		return explainSlackError(err, apiHint(err.Error(), target))
+	}
+	logRoutine("Message sent", append(logAttrs, "channel", channelID, "timestamp", timestamp)...)
+	return nil
+}
+
+// apiHint explains what to do about a Web API error code when posting to target, empty for unknown codes
+func apiHint(code string, target string) string {
+	switch code {
+	case "missing_scope":
+		return "the bot lacks the chat:write scope, add it and reinstall the app"
+	case "channel_not_found":
+		return fmt.Sprintf("channel %s not found or the bot isn't invited to it", target)
+	case "not_in_channel":
+		return fmt.Sprintf("the bot isn't a member of %s, invite it to the channel", target)
+	case "is_archived":
+		return fmt.Sprintf("channel %s is archived", target)
+	case "invalid_auth", "not_authed":
+		return "the Slack token isn't valid"
+	case "token_revoked", "account_inactive":
+		return "the token was revoked or the app uninstalled, create a new token"
+	}
+	return ""
+}
+
+// webhookHint explains what to do about an Incoming Webhook error body, empty for unknown ones
+func webhookHint(body string) string {
+	switch body {
+	case "invalid_token", "no_service", "no_active_hooks":
+		return "the webhook was disabled or removed, create a new one"
+	case "channel_not_found":
+		return "the channel of the webhook was deleted"
+	case "channel_is_archived":
+		return "the channel of the webhook is archived"
+	case "action_prohibited":
+		return "an admin restricted posting to the channel of the webhook"
+	}
+	return ""
+}
+
+// explainSlackError adds hint to err if there is one, keeping err wrapped
+func explainSlackError(err error, hint string) error {
+	if hint == "" {
+		return err
+	}
+	return fmt.Errorf("%w (%s)", err, hint)
+}
+
+// httpClient returns HTTPClient, or http.DefaultClient if it isn't set
+func (n *SlackNotifier) httpClient() *http.Client {
+	if n.HTTPClient != nil {
+		return n.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+// api returns a Web API client for Token using httpClient
+func (n *SlackNotifier) api() *slack.Client {
+	return slack.New(n.Token, slack.OptionHTTPClient(n.httpClient()))
+}
+
+// identity returns the message options carrying the bot identity, leaving out the unset ones
+func (n *SlackNotifier) identity() []slack.MsgOption {
+	var options []slack.MsgOption
+	if n.Username != "" {
+		options = append(options, slack.MsgOptionUsername(n.Username))
+	}
+	if n.IconEmoji != "" {
+		options = append(options, slack.MsgOptionIconEmoji(n.IconEmoji))
+	}
+	if n.IconURL != "" {
+		options = append(options, slack.MsgOptionIconURL(n.IconURL))
+	}
+	return options
+}
+
+// threadRoot returns today's "Disk report" message for target, posting it first if there is none yet.
+// The lock is held while posting so that concurrent reports share a single root.
+func (n *SlackNotifier) threadRoot(ctx context.Context, api *slack.Client, target string) (threadRoot, error) {
+	n.threadsMu.Lock()
+	defer n.threadsMu.Unlock()
+	day := time.Now().Format("2006-01-02")
+	key := target + " " + day
+	if root, ok := n.threads[key]; ok {
+		return root, nil
+	}
+	channelID, timestamp, err := api.PostMessageContext(ctx, target, append(n.identity(), slack.MsgOptionText("*Disk report* "+day, false))...)
+	if err != nil {
+		return threadRoot{}, fmt.Errorf("Couldn't start thread: %w", explainSlackError(err, apiHint(err.Error(), target)))
+	}
+	if n.threads == nil {
+		n.threads = make(map[string]threadRoot)
+	}
+	// Roots of earlier days are never posted under again
+	for rootKey, root := range n.threads {
+		if root.day != day {
+			delete(n.threads, rootKey)
+		}
+	}
+	root := threadRoot{day: day, channel: channelID, timestamp: timestamp}
+	n.threads[key] = root
+	logRoutine("Thread started", "channel", channelID, "timestamp", timestamp)
+	return root, nil
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// TestThreadRootPrunesEarlierDays starts today's thread, which drops the roots of earlier days that used to pile up
+// in -interval daemons
+func TestThreadRootPrunesEarlierDays(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"ok": true, "channel": "C123", "ts": "1700000000.000100"}`))
+	}))
+	defer server.Close()
+	api := slack.New("xoxb-test", slack.OptionAPIURL(server.URL+"/"))
+
+	yesterday := time.Now().AddDate(0, 0, -1).Format("2006-01-02")
+	notifier := &SlackNotifier{Thread: true, threads: map[string]threadRoot{
+		"#ops " + yesterday: {day: yesterday, channel: "C123", timestamp: "1699900000.000100"},
+		"#dba " + yesterday: {day: yesterday, channel: "C456", timestamp: "1699900000.000200"},
+	}}
+	root, err := notifier.threadRoot(context.Background(), api, "#ops")
+	if err != nil {
+		t.Fatalf("threadRoot() failed: %v", err)
+	}
+	if root.timestamp != "1700000000.000100" {
+		t.Errorf("threadRoot() = %+v, want today's root", root)
+	}
+	if len(notifier.threads) != 1 {
+		t.Errorf("%d thread roots kept, want today's alone: %v", len(notifier.threads), notifier.threads)
+	}
+	if again, _ := notifier.threadRoot(context.Background(), api, "#ops"); again != root {
+		t.Errorf("threadRoot() = %+v on the same day, want %+v", again, root)
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// alertState is what a Monitor remembers about a disk below its threshold
+type alertState struct {
+	LastAlert      time.Time `json:"last_alert"`
+	FreePercentage uint64    `json:"free_percentage"`
+	// Severity is the severity of the last alert, so that an escalation isn't held back by RemindAfter
+	Severity string `json:"severity,omitempty"`
+}
+
+// LoadState reads the alert state saved by SaveState from path, so that -remind-after and recovery reports
+// work across runs. A missing or corrupt file starts with a fresh state.
+func (m *Monitor) LoadState(path string) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return
+	}
+	if err != nil {
+		slog.Warn("Couldn't read state file, starting fresh", "path", path, "error", err)
+		return
+	}
+	alerted := make(map[string]alertState)
+	if err := json.Unmarshal(data, &alerted); err != nil {
+		slog.Warn("Corrupt state file, starting fresh", "path", path, "error", err)
+		return
+	}
+	m.alerted = alerted
+}
+
+// SaveState writes the alert state to path as JSON, replacing the file atomically
+func (m *Monitor) SaveState(path string) error {
+	alerted := m.alerted
+	if alerted == nil {
+		alerted = make(map[string]alertState)
+	}
+	data, err := json.MarshalIndent(alerted, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/danthelion/diskspace2slack/diskspace"
+)
+
+// TeamsNotifier posts alerts as MessageCards to a Microsoft Teams Incoming Webhook.
+// Disks below the critical level of their threshold, or Critical percent, are colored as critical instead of warning.
+// Posts that take longer than Timeout, or defaultHTTPTimeout if it is zero, are aborted.
+type TeamsNotifier struct {
+	WebhookURL string
+	Critical   uint64
+	Timeout    time.Duration
+}
+
+// teamsColors are the MessageCard theme colors by Severity
+var teamsColors = map[string]string{
+	"danger":  "D00000",
+	"warning": "FFA500",
+	"good":    "2EB886",
+}
+
+// teamsCard is the JSON payload of a legacy MessageCard
+type teamsCard struct {
+	Type       string         `json:"@type"`
+	Context    string         `json:"@context"`
+	ThemeColor string         `json:"themeColor"`
+	Summary    string         `json:"summary"`
+	Title      string         `json:"title"`
+	Sections   []teamsSection `json:"sections"`
+}
+
+// teamsSection holds the facts of a MessageCard
+type teamsSection struct {
+	Facts []teamsFact `json:"facts"`
+}
+
+// teamsFact is a name/value line of a MessageCard
+type teamsFact struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// ValidateHTTPSURL checks that raw is an absolute https:// URL, as required for webhooks carrying alerts
+func ValidateHTTPSURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return fmt.Errorf("Invalid webhook URL %q: must be an https:// URL", raw)
+	}
+	return nil
+}
+
+// card renders alert as a MessageCard colored by severity
+func (n *TeamsNotifier) card(alert Alert) teamsCard {
+	disk := alert.Disk
+	color := Severity(alert, n.Critical)
+	title := fmt.Sprintf("%s on %s:%s", alert.Problem(), disk.Host, disk.Name)
+	if alert.Recovered {
+		color = "good"
+		title = fmt.Sprintf("Disk space recovered on %s:%s", disk.Host, disk.Name)
+	}
+	return teamsCard{
+		Type:       "MessageCard",
+		Context:    "https://schema.org/extensions",
+		ThemeColor: teamsColors[color],
+		Summary:    title,
+		Title:      title,
+		Sections: []teamsSection{{Facts: []teamsFact{
+			{Name: "Total", Value: diskspace.FormatBytes(disk.All)},
+			{Name: "Free", Value: diskspace.FormatBytes(disk.Free)},
+			{Name: "Used", Value: diskspace.FormatBytes(disk.Used)},
+			{Name: "Free %", Value: fmt.Sprintf("%d%%", disk.FreePercentage)},
+			{Name: "Used %", Value: fmt.Sprintf("%d%%", disk.UsedPercentage)},
+			{Name: "Threshold", Value: alert.Threshold.String()},
+		}}},
+	}
+}
+
+// Notify posts alert to the webhook
+func (n *TeamsNotifier) Notify(ctx context.Context, alert Alert) error {
+	payload, err := json.Marshal(n.card(alert))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.WebhookURL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := timeoutClient(n.Timeout).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("Teams returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	logRoutine("Message sent to Teams", alert.LogAttrs()...)
+	return nil
+}
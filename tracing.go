@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"os"
+
+	"github.com/danthelion/diskspace2slack/diskspace"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName is the instrumentation scope of all spans
+const tracerName = "github.com/danthelion/diskspace2slack"
+
+// SetupTracing exports spans over OTLP/HTTP if an endpoint is configured through the standard
+// OTEL_EXPORTER_OTLP_ENDPOINT or OTEL_EXPORTER_OTLP_TRACES_ENDPOINT environment variables, which the exporter reads
+// along with the other OTEL_* settings. Otherwise the global no-op tracer stays in place.
+// The returned function flushes pending spans and has to be called before exiting.
+func SetupTracing(ctx context.Context) (func(context.Context) error, error) {
+	_, endpoint := os.LookupEnv("OTEL_EXPORTER_OTLP_ENDPOINT")
+	_, tracesEndpoint := os.LookupEnv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")
+	if !(endpoint || tracesEndpoint) || os.Getenv("OTEL_TRACES_EXPORTER") == "none" {
+		return func(context.Context) error { return nil }, nil
+	}
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter))
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// startSpan starts a span named name as a child of the span in ctx
+func startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// endSpan records err on span if set, then ends it
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// diskAttrs are the span attributes of disk
+func diskAttrs(disk diskspace.DiskState) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("disk.host", disk.Host),
+		attribute.String("disk.path", disk.Name),
+		attribute.Int64("disk.free_pct", int64(disk.FreePercentage)),
+	}
+}